@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	core "jplugins/coremgt"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/forj-oss/forjj-modules/trace"
+)
+
+type cmdBundle struct {
+	cmd             *kingpin.CmdClause
+	lockFile        *string
+	output          *string
+	featureRepoPath *string
+	featureRepoURL  *string
+	featureRepoRef  *string
+	strict          *bool
+	jobs            *int
+	cachePath       *string
+	noCache         *bool
+}
+
+func (c *cmdBundle) init() {
+	c.cmd = App.app.Command("bundle", "Build a tar.gz bundle of the verified plugins, groovies and files of the 'jplugins.lock', to install offline.")
+	c.lockFile = c.cmd.Flag("lock-file", "Full path to the lock file.").Default(lockFileName).String()
+	c.output = c.cmd.Flag("output", "Bundle file to write.").Short('o').Default("plugins.tar.gz").String()
+	c.featureRepoPath = c.cmd.Flag("features-repo-path", "Path to a feature repository. "+
+		"By default, jplugins store the repo clone in jplugins cache directory.").Default(defaultFeaturesRepoPath).String()
+	c.featureRepoURL = c.cmd.Flag("features-repo-url", "URL to the feature repository.").Default(defaultFeaturesRepoURL).String()
+	c.featureRepoRef = c.cmd.Flag("features-repo-ref", "Branch, tag or commit ID of the feature repository to checkout.").String()
+	c.strict = c.cmd.Flag("strict", "Fail if the features file or features descriptors have changed since the lock file was written.").Bool()
+	c.jobs = c.cmd.Flag("jobs", "Number of plugins downloaded in parallel.").Default(strconv.Itoa(core.DefaultJobs)).Int()
+	c.cachePath = c.cmd.Flag("cache-path", "Path to the plugins packages cache, shared by installs.").Default(defaultPluginsCachePath).String()
+	c.noCache = c.cmd.Flag("no-cache", "Do not use the plugins packages cache.").Bool()
+}
+
+// doBundle write the bundle of the lock file.
+func (c *cmdBundle) doBundle() {
+	App.repository = core.NewRepository()
+	if !App.repository.LoadFromURL() {
+		os.Exit(1)
+	}
+
+	elements, err := App.readFromSimpleFormat("", *c.lockFile)
+	if err != nil {
+		gotrace.Error("%s", err)
+		os.Exit(1)
+	}
+
+	fromFeatures := len(elements.GetElements("groovy")) + len(elements.GetElements("casc")) + len(elements.GetElements("file"))
+	if fromFeatures > 0 && !App.prepareFeaturesRepo(*c.featureRepoPath, *c.featureRepoURL, *c.featureRepoRef) {
+		os.Exit(1)
+	}
+	if !App.checkLockSources(*c.lockFile, *c.featureRepoPath, *c.strict) {
+		os.Exit(1)
+	}
+
+	manifest, err := core.WriteBundle(elements, *c.featureRepoPath, *c.lockFile, *c.output, *c.jobs, App.pluginsCache(*c.cachePath, 0, *c.noCache))
+	if err != nil {
+		gotrace.Error("%s. Process aborted.", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%d file(s) bundled in '%s'.\n", len(manifest.Files), *c.output)
+}
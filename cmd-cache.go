@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	core "jplugins/coremgt"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/forj-oss/forjj-modules/trace"
+)
+
+type cmdCache struct {
+	cmd       *kingpin.CmdClause
+	gc        cmdCacheGC
+	cachePath *string
+}
+
+type cmdCacheGC struct {
+	cmd     *kingpin.CmdClause
+	maxSize *int
+}
+
+func (c *cmdCache) init() {
+	c.cmd = App.app.Command("cache", "Manage the plugins packages cache.")
+	c.cachePath = c.cmd.Flag("cache-path", "Path to the plugins packages cache.").Default(defaultPluginsCachePath).String()
+
+	c.gc.cmd = c.cmd.Command("gc", "Remove packages not indexed, then least recently used packages over the maximum cache size.")
+	c.gc.maxSize = c.gc.cmd.Flag("max-size", "Maximum cache size in MB. 0 means no limit.").Default(defaultCacheMaxSize).Int()
+}
+
+// DoCacheGC clean up the plugins cache.
+func (c *cmdCache) DoCacheGC() {
+	cache := core.NewPluginsCache(*c.cachePath, int64(*c.gc.maxSize)*1024*1024)
+	removed, freed, err := cache.GC()
+	if err != nil {
+		gotrace.Error("%s", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%d package(s) removed from %s. %d MB freed.\n", removed, cache.Path(), freed/1024/1024)
+}
+
+// pluginsCache return the plugins cache to use, or nil if disabled.
+func (a *jPluginsApp) pluginsCache(cachePath string, maxSize int, noCache bool) *core.PluginsCache {
+	if noCache {
+		return nil
+	}
+	return core.NewPluginsCache(cachePath, int64(maxSize)*1024*1024)
+}
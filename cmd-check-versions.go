@@ -5,6 +5,7 @@ import (
 	core "jplugins/coremgt"
 	"jplugins/utils"
 	"log"
+	"os"
 	"path"
 
 	"github.com/alecthomas/kingpin"
@@ -15,6 +16,9 @@ type cmdCheckVersions struct {
 	cmd             *kingpin.CmdClause
 	jenkinsHomePath *string
 	useJenkinsHome  *bool
+	jenkinsURL      *string
+	jenkinsUser     *string
+	jenkinsToken    *string
 
 	usePreInstalled  *bool
 	preInstalledPath *string
@@ -22,9 +26,11 @@ type cmdCheckVersions struct {
 	pluginsLock         *string
 	usePluginLock       *bool
 	usePluginLockBackup *bool
+	strict              *bool
 
 	featureRepoPath    *string
 	featureRepoURL     *string
+	featureRepoRef     *string
 	pluginsFeaturePath *string
 	pluginsFeatureFile *string
 	usePluginFeature   *bool
@@ -34,6 +40,7 @@ type cmdCheckVersions struct {
 	exportPath     *string
 
 	updates *core.PluginsStatus
+	drift   *core.Drift
 	forcely bool
 }
 
@@ -44,12 +51,18 @@ const (
 	lockBakCheck      = "jplugins backup lock file"
 	featuresCheck     = "jplugins features file"
 	preInstallCheck   = "jplugins pre-installed file"
+
+	// driftExitCode is the exit code when the Jenkins home has drifted from the lock file. Errors exit with 1.
+	driftExitCode = 2
 )
 
 func (c *cmdCheckVersions) init() {
 	c.cmd = App.app.Command("check-updates", "Display Jenkins plugins which has updates available from existing Jenkins installation.")
 	c.jenkinsHomePath = c.cmd.Flag("jenkins-home", "Where Jenkins is installed.").Default(defaultJenkinsHome).String()
 	c.useJenkinsHome = c.cmd.Flag("use-jenkins-home", "To use jenkins home plugins list exclusively.").Bool()
+	c.jenkinsURL = c.cmd.Flag("jenkins-url", "URL of a running Jenkins to read plugins from its REST API, instead of the Jenkins home.").String()
+	c.jenkinsUser = c.cmd.Flag("jenkins-user", "Jenkins user for --jenkins-url.").Envar("JENKINS_USER").String()
+	c.jenkinsToken = c.cmd.Flag("jenkins-token", "Jenkins user API token for --jenkins-url.").Envar("JENKINS_TOKEN").String()
 
 	c.usePreInstalled = c.cmd.Flag("use-pre-installed", "To use pre-installed list file exclusively.").Bool()
 	c.preInstalledPath = c.cmd.Flag("pre-installed-path", "Path to the pre-installed.lst file.").Default(defaultJenkinsHome).String()
@@ -57,10 +70,12 @@ func (c *cmdCheckVersions) init() {
 	c.pluginsLock = c.cmd.Flag("lock-file", "Path to the jplugins.lock file.").Default(".").String()
 	c.usePluginLock = c.cmd.Flag("use-lock-file", "To use lock file exclusively.").Bool()
 	c.usePluginLockBackup = c.cmd.Flag("use-bak-lock-file", "To use backup lock file as old version and compare with new lock file.").Bool()
+	c.strict = c.cmd.Flag("strict", "Fail if the features file or features descriptors have changed since the lock file was written.").Bool()
 
 	c.featureRepoPath = c.cmd.Flag("features-repo-path", "Path to a feature repository. "+
 		"By default, jplugins store the repo clone in jplugins cache directory.").Default(defaultFeaturesRepoPath).String()
-	c.featureRepoURL = c.cmd.Flag("features-repo-url", "URL to the feature repository. NOT IMPLEMENTED").Default(defaultFeaturesRepoURL).String()
+	c.featureRepoURL = c.cmd.Flag("features-repo-url", "URL to the feature repository.").Default(defaultFeaturesRepoURL).String()
+	c.featureRepoRef = c.cmd.Flag("features-repo-ref", "Branch, tag or commit ID of the feature repository to checkout.").String()
 
 	c.pluginsFeaturePath = c.cmd.Flag("features-path", "Path to the features.lst file.").String()
 	c.pluginsFeatureFile = c.cmd.Flag("features-filename", "Feature file name.").Default(featureFileName).String()
@@ -75,11 +90,25 @@ func (c *cmdCheckVersions) doCheckInstalled() {
 	choices := c.identifySource()
 
 	App.setJenkinsHome(*c.jenkinsHomePath)
+	App.setJenkinsURL(*c.jenkinsURL, *c.jenkinsUser, *c.jenkinsToken)
+
+	if App.checkSimpleFormatFile(*c.pluginsLock, lockFileName) &&
+		!App.checkLockSources(path.Join(*c.pluginsLock, lockFileName), *c.featureRepoPath, *c.strict) {
+		os.Exit(1)
+	}
 
 	if err := choices.Run(); err != nil {
 		log.Fatalf("Check update issue. %s.", err)
 		return
 	}
+	if c.drift != nil {
+		// Drift is reported with a dedicated exit code, to monitor changes applied out of jplugins.
+		c.drift.PrintText(os.Stdout)
+		if c.drift.Length() > 0 {
+			os.Exit(driftExitCode)
+		}
+		return
+	}
 	repo := App.repository
 
 	if !*c.export {
@@ -121,7 +150,11 @@ func (c *cmdCheckVersions) identifySource() (choices *utils.UpdatesSelect) {
 	c.forcely = *c.useJenkinsHome || *c.usePluginLock || *c.usePreInstalled || *c.usePluginFeature || *c.usePluginLockBackup
 
 	// A Jenkins home is found if it contains plugins and init.groovy.d directories by default in /var/jenkins_home
+	// A Jenkins URL replaces the Jenkins home.
 	choices.SetCheck(jenkinsHomeCheck, func() bool {
+		if *c.jenkinsURL != "" {
+			return c.checkOptions(App.checkJenkinsHome(), *c.useJenkinsHome, "Jenkins", *c.jenkinsURL)
+		}
 		return c.checkOptions(
 			App.checkJenkinsHome(),
 			*c.useJenkinsHome, "Jenkins home",
@@ -188,11 +221,45 @@ func (c *cmdCheckVersions) identifySource() (choices *utils.UpdatesSelect) {
 	return
 }
 
-// localJenkinsHomeUpdates check local files against Jenkins home
-func (c *cmdCheckVersions) localJenkinsHomeUpdates(choice utils.UpdatesSelectChoice, states map[string]bool) error {
+// localJenkinsHomeUpdates check the Jenkins home against the lock file, to detect plugins, groovies and files
+// changed out of jplugins. The lock file is verified against the features file with its sources. (see --strict)
+//
+// Without lock file, Jenkins home updates are checked instead.
+func (c *cmdCheckVersions) localJenkinsHomeUpdates(choice utils.UpdatesSelectChoice, states map[string]bool) (err error) {
 	gotrace.Info(choice.Choice)
-	gotrace.Warning("This use case is currently not available. It will be implemented later.")
-	return nil
+	if !states[lockCheck] {
+		gotrace.Warning("No lock file to compare with the Jenkins home. Create it with 'jplugins init lockfile'. Checking Jenkins updates instead.")
+		return c.jenkinsHomeUpdates(choice, states)
+	}
+
+	// The repository gives plugins sha256.
+	App.repository = core.NewRepository()
+	if !App.repository.LoadFromURL() {
+		return fmt.Errorf("Issue to load remote repository list")
+	}
+
+	elements, err := App.readFromSimpleFormat(*c.pluginsLock, lockFileName)
+	if err != nil {
+		return
+	}
+
+	if App.jenkinsRemote != nil {
+		installed, err := App.readFromJenkins()
+		if err != nil {
+			return err
+		}
+		gotrace.Warning("Only plugins versions and states are compared with a Jenkins URL.")
+		c.drift = core.NewPluginsDrift(App.jenkinsRemote.String(), elements, installed)
+		return nil
+	}
+
+	fromFeatures := len(elements.GetElements("groovy")) + len(elements.GetElements("casc")) + len(elements.GetElements("file"))
+	if fromFeatures > 0 && !App.prepareFeaturesRepo(*c.featureRepoPath, *c.featureRepoURL, *c.featureRepoRef) {
+		return fmt.Errorf("Unable to prepare the features repository")
+	}
+
+	c.drift, err = App.jenkinsHome.CheckDrift(elements, *c.featureRepoPath)
+	return
 }
 
 // jenkinsHomeUpdates show update of Jenkins Home from Jenkins updates
@@ -231,7 +298,7 @@ func (c *cmdCheckVersions) jenkinsUpdates(choice utils.UpdatesSelectChoice, stat
 		c.updates = repo.Compare(elements)
 	} else if states[featuresCheck] {
 		// Load defined features to get plugins list and create a lock data in mem.
-		elements, err := App.readFeaturesFromSimpleFormat(*c.featureRepoPath, path.Join(*c.pluginsFeaturePath, *c.pluginsFeatureFile), *c.featureRepoURL)
+		elements, err := App.readFeaturesFromSimpleFormat(*c.featureRepoPath, path.Join(*c.pluginsFeaturePath, *c.pluginsFeatureFile), *c.featureRepoURL, *c.featureRepoRef)
 		if err != nil {
 			return fmt.Errorf("Unable to check updates. %s", err)
 		}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	core "jplugins/coremgt"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/forj-oss/forjj-modules/trace"
+	git "github.com/forj-oss/go-git"
+)
+
+type cmdDiff struct {
+	cmd       *kingpin.CmdClause
+	oldSource *string
+	newSource *string
+	format    *string
+
+	jenkinsUser  *string
+	jenkinsToken *string
+}
+
+const (
+	gitSourcePrefix   = "git:"
+	httpSourcePrefix  = "http://"
+	httpsSourcePrefix = "https://"
+	textFormat        = "text"
+	markdownFormat    = "markdown"
+	jsonFormat        = "json"
+)
+
+func (c *cmdDiff) init() {
+	c.cmd = App.app.Command("diff", "Compare 2 lock files or pre-installed lists. A git reference can be given as 'git:<ref>:<file>', ie 'git:HEAD~1:jplugins.lock'. "+
+		"A running Jenkins can be given by its URL, ie 'https://jenkins.example.com'.")
+	c.oldSource = c.cmd.Arg("old", "Old lock file, pre-installed list, git reference or Jenkins URL.").Required().String()
+	c.newSource = c.cmd.Arg("new", "New lock file, pre-installed list, git reference or Jenkins URL.").Default(lockFileName).String()
+	c.format = c.cmd.Flag("format", "Output format: text, markdown (GitHub flavoured) or json.").Default(textFormat).Enum(textFormat, markdownFormat, jsonFormat)
+	c.jenkinsUser = c.cmd.Flag("jenkins-user", "Jenkins user for a Jenkins URL source.").Envar("JENKINS_USER").String()
+	c.jenkinsToken = c.cmd.Flag("jenkins-token", "Jenkins user API token for a Jenkins URL source.").Envar("JENKINS_TOKEN").String()
+}
+
+func (c *cmdDiff) doDiff() {
+	oldElements, err := c.readSource(*c.oldSource)
+	if err != nil {
+		gotrace.Error("%s", err)
+		os.Exit(1)
+	}
+
+	newElements, err := c.readSource(*c.newSource)
+	if err != nil {
+		gotrace.Error("%s", err)
+		os.Exit(1)
+	}
+
+	diff := core.NewElementsDiff(*c.oldSource, oldElements, *c.newSource, newElements)
+
+	switch *c.format {
+	case markdownFormat:
+		diff.PrintMarkdown(os.Stdout)
+	case jsonFormat:
+		if err := diff.PrintJSON(os.Stdout); err != nil {
+			gotrace.Error("%s", err)
+			os.Exit(1)
+		}
+	default:
+		diff.PrintText(os.Stdout)
+	}
+}
+
+// readSource read plugins installed in a running Jenkins if the source is a URL, or a file or git reference otherwise.
+func (c *cmdDiff) readSource(source string) (elements *core.ElementsType, err error) {
+	if !strings.HasPrefix(source, httpSourcePrefix) && !strings.HasPrefix(source, httpsSourcePrefix) {
+		return App.readElementsFromSource(source)
+	}
+	jenkins := core.NewJenkinsRemote(source)
+	jenkins.SetAuth(*c.jenkinsUser, *c.jenkinsToken)
+	return jenkins.GetPlugins()
+}
+
+// readElementsFromSource read a simple format file (lock or pre-installed) from a file or a git reference.
+//
+// A git reference is given as 'git:<ref>:<file>'. The file is read from the current git repository.
+func (a *jPluginsApp) readElementsFromSource(source string) (elements *core.ElementsType, err error) {
+	file := source
+
+	if strings.HasPrefix(source, gitSourcePrefix) {
+		gitRef := strings.SplitN(strings.TrimPrefix(source, gitSourcePrefix), ":", 2)
+		if len(gitRef) != 2 || gitRef[0] == "" || gitRef[1] == "" {
+			return nil, fmt.Errorf("Invalid git reference '%s'. Expect 'git:<ref>:<file>'", source)
+		}
+
+		var data string
+		if data, err = git.Get("show", gitRef[0]+":"+gitRef[1]); err != nil {
+			return nil, fmt.Errorf("Unable to read '%s' from git. %s", source, err)
+		}
+
+		var tmpFile *os.File
+		if tmpFile, err = ioutil.TempFile("", "jplugins-diff-"); err != nil {
+			return nil, fmt.Errorf("Unable to create a temporary file. %s", err)
+		}
+		defer os.Remove(tmpFile.Name())
+
+		_, err = tmpFile.WriteString(data)
+		tmpFile.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to write '%s'. %s", tmpFile.Name(), err)
+		}
+		file = tmpFile.Name()
+	}
+
+	if !a.checkSimpleFormatFile(path.Dir(file), path.Base(file)) {
+		return nil, fmt.Errorf("'%s' is not found or is not a file", file)
+	}
+
+	elements = core.NewElementsType()
+	elements.AddSupport("plugin", "groovy", "casc", "file")
+	for _, elementType := range []string{"groovy", "casc", "file"} {
+		elements.AddSupportContext(elementType, "noMoreContext", "true")
+	}
+	elements.NoRecursiveChain()
+
+	if err = elements.Read(file, 3); err != nil {
+		return nil, fmt.Errorf("Unable to read '%s'. %s", source, err)
+	}
+	return
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+
+	core "jplugins/coremgt"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/forj-oss/forjj-modules/trace"
+)
+
+type cmdExport struct {
+	cmd      *kingpin.CmdClause
+	lockFile *string
+	format   *string
+	output   *string
+}
+
+func (c *cmdExport) init() {
+	c.cmd = App.app.Command("export", "Export plugins of the 'jplugins.lock' as plugins.txt or plugins.yaml (plugin installation manager).")
+	c.lockFile = c.cmd.Flag("lock-file", "Full path to the lock file.").Default(lockFileName).String()
+	c.format = c.cmd.Flag("format", "Export format: plugins.txt or plugins.yaml.").Default(core.PluginsTxtFormat).Enum(core.PluginsTxtFormat, core.PluginsYamlFormat)
+	c.output = c.cmd.Flag("output", "File to write. By default, the standard output.").Short('o').String()
+}
+
+// doExport write the lock file plugins in the format requested.
+func (c *cmdExport) doExport() {
+	elements, err := App.readFromSimpleFormat("", *c.lockFile)
+	if err != nil {
+		gotrace.Error("%s", err)
+		os.Exit(1)
+	}
+
+	out := os.Stdout
+	if *c.output != "" {
+		if out, err = os.Create(*c.output); err != nil {
+			gotrace.Error("Unable to create '%s'. %s", *c.output, err)
+			os.Exit(1)
+		}
+		defer out.Close()
+	}
+
+	skipped, err := core.ExportPlugins(elements, *c.format, out)
+	if err != nil {
+		gotrace.Error("%s", err)
+		os.Exit(1)
+	}
+	if skipped > 0 {
+		gotrace.Warning("%d groovies, files or plugin states cannot be exported as %s. Ignored.", skipped, *c.format)
+	}
+}
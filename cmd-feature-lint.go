@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	core "jplugins/coremgt"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/forj-oss/forjj-modules/trace"
+)
+
+type cmdFeatureLint struct {
+	cmd     *kingpin.CmdClause
+	offline *bool
+}
+
+func (c *cmdFeatureLint) init(parent *kingpin.CmdClause) {
+	c.cmd = parent.Command("lint", "Validate every feature descriptor of the features repository. Exit 1 if errors are found.")
+	c.offline = c.cmd.Flag("offline", "Do not check plugins against the updates repository.").Bool()
+}
+
+// DoFeatureLint report features descriptors issues as '<file>:<line>: <severity>: <message>'
+func (c *cmdFeatureLint) DoFeatureLint() {
+	featureCmd := App.featureCmd
+	if !App.prepareFeaturesRepo(*featureCmd.featureRepoPath, *featureCmd.featureRepoURL, *featureCmd.featureRepoRef) {
+		os.Exit(1)
+	}
+
+	if !*c.offline {
+		App.repository = core.NewRepository()
+		if !App.repository.LoadFromURL() {
+			os.Exit(1)
+		}
+	}
+
+	lint := core.NewFeaturesLint(*featureCmd.featureRepoPath, App.repository)
+	diagnostics, err := lint.Lint()
+	if err != nil {
+		gotrace.Error("%s", err)
+		os.Exit(1)
+	}
+
+	if *featureCmd.format == jsonFormat {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(diagnostics); err != nil {
+			gotrace.Error("Unable to encode diagnostics in JSON. %s", err)
+			os.Exit(1)
+		}
+	} else {
+		for _, diagnostic := range diagnostics {
+			fmt.Println(diagnostic)
+		}
+	}
+
+	if errors := lint.Errors(); errors > 0 {
+		gotrace.Error("%d error(s) and %d warning(s) found.", errors, len(diagnostics)-errors)
+		os.Exit(1)
+	}
+	gotrace.Info("%d warning(s) found.", len(diagnostics))
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	core "jplugins/coremgt"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/forj-oss/forjj-modules/trace"
+)
+
+type cmdFeatureList struct {
+	cmd *kingpin.CmdClause
+}
+
+func (c *cmdFeatureList) init(parent *kingpin.CmdClause) {
+	c.cmd = parent.Command("list", "List features found in the features repository, with their description.").Default()
+}
+
+// DoFeatureList display the list of features found in the features repository.
+func (c *cmdFeatureList) DoFeatureList() {
+	featureCmd := App.featureCmd
+	if !App.prepareFeaturesRepo(*featureCmd.featureRepoPath, *featureCmd.featureRepoURL, *featureCmd.featureRepoRef) {
+		os.Exit(1)
+	}
+
+	features, err := core.ListFeatures(*featureCmd.featureRepoPath)
+	if err != nil {
+		gotrace.Error("%s", err)
+		os.Exit(1)
+	}
+
+	if *featureCmd.format == jsonFormat {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(features); err != nil {
+			gotrace.Error("Unable to encode features list in JSON. %s", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	iMaxName := 0
+	for _, feature := range features {
+		if size := len(feature.Name); size > iMaxName {
+			iMaxName = size
+		}
+	}
+	for _, feature := range features {
+		description := strings.Split(feature.Description, "\n")[0]
+		fmt.Printf("%-"+strconv.Itoa(iMaxName)+"s  %s\n", feature.Name, description)
+	}
+	fmt.Printf("\n%d feature(s)\n", len(features))
+}
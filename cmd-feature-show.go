@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+
+	core "jplugins/coremgt"
+	"jplugins/utils"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/forj-oss/forjj-modules/trace"
+)
+
+type cmdFeatureShow struct {
+	cmd         *kingpin.CmdClause
+	name        *string
+	ref         *string
+	featureFile *string
+}
+
+func (c *cmdFeatureShow) init(parent *kingpin.CmdClause) {
+	c.cmd = parent.Command("show", "Show plugins, groovies and files brought by a feature, with resolved versions and commit IDs.")
+	c.name = c.cmd.Arg("name", "Feature name, as '[<repo>/]<feature>'.").Required().String()
+	c.ref = c.cmd.Flag("ref", "Branch, tag or commit ID to read the feature from.").String()
+	c.featureFile = c.cmd.Flag("feature-file", "Features file to read named features repositories ('repo:' lines) from, if it exists.").Default(featureFileName).String()
+}
+
+// DoFeatureShow display the expanded content of a feature.
+func (c *cmdFeatureShow) DoFeatureShow() {
+	featureCmd := App.featureCmd
+
+	App.repository = core.NewRepository()
+	repo := App.repository
+	if !repo.LoadFromURL() {
+		os.Exit(1)
+	}
+
+	elements := core.NewElementsType()
+	if *featureCmd.featureRepoPath != defaultFeaturesRepoPath {
+		elements.SetLocal()
+	}
+	elements.SetFeaturesPath(*featureCmd.featureRepoPath)
+	elements.SetFeaturesRepoURL(*featureCmd.featureRepoURL)
+	elements.SetFeaturesRepoRef(*featureCmd.featureRepoRef)
+	elements.SetRepository(repo)
+
+	if utils.CheckFile(path.Dir(*c.featureFile), path.Base(*c.featureFile)) {
+		if err := elements.ReadFeaturesRepos(*c.featureFile); err != nil {
+			gotrace.Error("%s", err)
+			os.Exit(1)
+		}
+	}
+
+	details, err := elements.FeatureDetails(*c.name, *c.ref)
+	if err != nil {
+		gotrace.Error("%s", err)
+		os.Exit(1)
+	}
+
+	if *featureCmd.format == jsonFormat {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(details); err != nil {
+			gotrace.Error("Unable to encode feature details in JSON. %s", err)
+			os.Exit(1)
+		}
+		return
+	}
+	c.printDetails(details)
+}
+
+func (c *cmdFeatureShow) printDetails(details *core.FeatureDetails) {
+	if details.Ref != "" {
+		fmt.Printf("Feature: %s (%s)\n", details.Name, details.Ref)
+	} else {
+		fmt.Printf("Feature: %s\n", details.Name)
+	}
+	if details.Description != "" {
+		fmt.Printf("\n%s\n", details.Description)
+	}
+	if len(details.Features) > 0 {
+		fmt.Print("\nIncluded features:\n==========\n")
+		for _, feature := range details.Features {
+			fmt.Printf("- %s\n", feature)
+		}
+	}
+
+	iMaxName := 0
+	for _, elements := range [][]*core.FeatureElement{details.Plugins, details.Groovies, details.Files} {
+		for _, element := range elements {
+			if size := len(element.Type + ":" + element.Name); size > iMaxName {
+				iMaxName = size
+			}
+		}
+	}
+	nameFormat := "%-" + strconv.Itoa(iMaxName) + "s : %s"
+
+	for _, section := range []struct {
+		title    string
+		elements []*core.FeatureElement
+	}{
+		{"Plugins", details.Plugins},
+		{"Groovies", details.Groovies},
+		{"Files", details.Files},
+	} {
+		if len(section.elements) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s:\n==========\n", section.title)
+		for _, element := range section.elements {
+			fmt.Printf(nameFormat, element.Type+":"+element.Name, element.Version)
+			if element.Dest != "" {
+				fmt.Printf(" => %s", element.Dest)
+			}
+			if element.Feature != "" && element.Type == "plugin" {
+				fmt.Printf(" (feature: %s)", element.Feature)
+			}
+			fmt.Println()
+		}
+	}
+	fmt.Printf("\n%d plugin(s), %d groovy(ies), %d file(s)\n", len(details.Plugins), len(details.Groovies), len(details.Files))
+}
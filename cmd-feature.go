@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/alecthomas/kingpin"
+)
+
+type cmdFeature struct {
+	cmd             *kingpin.CmdClause
+	list            cmdFeatureList
+	show            cmdFeatureShow
+	lint            cmdFeatureLint
+	featureRepoPath *string
+	featureRepoURL  *string
+	featureRepoRef  *string
+	format          *string
+}
+
+func (c *cmdFeature) init() {
+	c.cmd = App.app.Command("feature", "Browse features of a features repository.")
+	c.featureRepoPath = c.cmd.Flag("features-repo-path", "Path to a feature repository. "+
+		"By default, jplugins store the repo clone in jplugins cache directory.").Default(defaultFeaturesRepoPath).String()
+	c.featureRepoURL = c.cmd.Flag("features-repo-url", "URL to the feature repository.").Default(defaultFeaturesRepoURL).String()
+	c.featureRepoRef = c.cmd.Flag("features-repo-ref", "Branch, tag or commit ID of the feature repository to checkout.").String()
+	c.format = c.cmd.Flag("format", "Output format: text or json.").Default(textFormat).Enum(textFormat, jsonFormat)
+
+	c.list.init(c.cmd)
+	c.show.init(c.cmd)
+	c.lint.init(c.cmd)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"strings"
 
 	"github.com/forj-oss/forjj-modules/trace"
 	core "jplugins/coremgt"
@@ -16,25 +17,59 @@ import (
 type cmdInitFeatures struct {
 	cmd             *kingpin.CmdClause
 	jenkinsHomePath *string
+	jenkinsURL      *string
+	jenkinsUser     *string
+	jenkinsToken    *string
 
 	pluginsFeaturePath *string
 	pluginsFeatureFile *string
 
 	replace *bool
+
+	importFile   *string
+	importFormat *string
+
+	withFeatures    *bool
+	minCoverage     *int
+	featureRepoPath *string
+	featureRepoURL  *string
+	featureRepoRef  *string
 }
 
 func (c *cmdInitFeatures) init(parent *kingpin.CmdClause) {
 	c.cmd = parent.Command("features", "Initialize the features file from Jenkins home.")
 	c.jenkinsHomePath = c.cmd.Flag("jenkins-home", "Path to the Jenkins home.").Default(defaultJenkinsHome).String()
+	c.jenkinsURL = c.cmd.Flag("jenkins-url", "URL of a running Jenkins to read plugins from its REST API, instead of the Jenkins home.").String()
+	c.jenkinsUser = c.cmd.Flag("jenkins-user", "Jenkins user for --jenkins-url.").Envar("JENKINS_USER").String()
+	c.jenkinsToken = c.cmd.Flag("jenkins-token", "Jenkins user API token for --jenkins-url.").Envar("JENKINS_TOKEN").String()
 	c.pluginsFeatureFile = c.cmd.Flag("feature-file", "Full path to a feature file. The path must exist.").Default(featureFileName).String()
 	c.pluginsFeaturePath = c.cmd.Flag("feature-path", "Feature file name to create.").Default(".").String()
 
 	c.replace = c.cmd.Flag("force", "force to re-create a feature file which already exist.").Bool()
 
+	c.importFile = c.cmd.Flag("import", "Create the feature file from a plugins.txt or plugins.yaml (plugin installation manager) file, instead of the Jenkins home.").String()
+	c.importFormat = c.cmd.Flag("import-format", "Format of the imported file. By default, detected from the file extension.").Enum(core.PluginsTxtFormat, core.PluginsYamlFormat)
+
+	c.withFeatures = c.cmd.Flag("with-features", "Detect features of the features repository installed in Jenkins home and write them instead of their plugins.").Bool()
+	c.minCoverage = c.cmd.Flag("min-coverage", "Minimum percentage of a feature plugins installed to select the feature.").Default("80").Int()
+	c.featureRepoPath = c.cmd.Flag("features-repo-path", "Path to a feature repository. "+
+		"By default, jplugins store the repo clone in jplugins cache directory.").Default(defaultFeaturesRepoPath).String()
+	c.featureRepoURL = c.cmd.Flag("features-repo-url", "URL to the feature repository.").Default(defaultFeaturesRepoURL).String()
+	c.featureRepoRef = c.cmd.Flag("features-repo-ref", "Branch, tag or commit ID of the feature repository to checkout.").String()
+
 }
 
 func (c *cmdInitFeatures) DoInitFeatures() {
+	if *c.importFile != "" {
+		if err := c.importFeatures(); err != nil {
+			gotrace.Error("Unable to create the feature file. %s", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	App.setJenkinsHome(*c.jenkinsHomePath)
+	App.setJenkinsURL(*c.jenkinsURL, *c.jenkinsUser, *c.jenkinsToken)
 
 	var elements *core.ElementsType
 	if App.checkJenkinsHome() {
@@ -70,6 +105,23 @@ func (c *cmdInitFeatures) saveFeatures(elements *core.ElementsType) (err error)
 
 	identified := elements.ExtractTopElements()
 
+	if *c.withFeatures {
+		if identified, err = c.suggestFeatures(elements); err != nil {
+			return
+		}
+	}
+
+	// Disabled or pinned plugins are kept with their states, even if brought by another plugin or feature.
+	for name, element := range elements.GetElements("plugin") {
+		plugin, ok := element.(*core.Plugin)
+		if !ok || len(plugin.States()) == 0 {
+			continue
+		}
+		if identified.GetElement("plugin", name) == nil {
+			identified.AddElement(plugin)
+		}
+	}
+
 	gotrace.Info("%d/%d plugin features detected. ", len(identified.GetElements("plugin")), len(elements.GetElements("plugin")))
 
 	if err = identified.WriteSimple(path.Join(*c.pluginsFeaturePath, *c.pluginsFeatureFile), 2); err != nil {
@@ -79,3 +131,66 @@ func (c *cmdInitFeatures) saveFeatures(elements *core.ElementsType) (err error)
 
 	return
 }
+
+// importFeatures create the feature file from a plugins.txt or plugins.yaml file.
+func (c *cmdInitFeatures) importFeatures() (err error) {
+	if utils.CheckFile(*c.pluginsFeaturePath, *c.pluginsFeatureFile) && !*c.replace {
+		return fmt.Errorf("'%s/%s' already exist. Use --force to replace it", *c.pluginsFeaturePath, *c.pluginsFeatureFile)
+	}
+
+	imported, err := core.ImportPlugins(*c.importFile, *c.importFormat)
+	if err != nil {
+		return
+	}
+	for _, warning := range imported.Warnings {
+		gotrace.Warning("%s", warning)
+	}
+
+	if err = imported.WriteSimple(path.Join(*c.pluginsFeaturePath, *c.pluginsFeatureFile)); err != nil {
+		return
+	}
+	gotrace.Info("%d plugin(s) imported from '%s'. %s/%s saved.", imported.Length(), *c.importFile, *c.pluginsFeaturePath, *c.pluginsFeatureFile)
+	return
+}
+
+// suggestFeatures select features mostly installed in Jenkins home and return them with top plugins not brought by those features.
+// The coverage of each feature and the list of unexplained plugins are displayed.
+func (c *cmdInitFeatures) suggestFeatures(elements *core.ElementsType) (identified *core.ElementsType, err error) {
+	if !App.prepareFeaturesRepo(*c.featureRepoPath, *c.featureRepoURL, *c.featureRepoRef) {
+		return nil, fmt.Errorf("Unable to use the features repository '%s'", *c.featureRepoPath)
+	}
+
+	suggestion, err := core.SuggestFeatures(*c.featureRepoPath, elements, *c.minCoverage)
+	if err != nil {
+		return
+	}
+
+	identified = core.NewElementsType()
+	identified.NoRecursiveChain()
+
+	fmt.Print("\nFeatures:\n==========\n")
+	for _, feature := range suggestion.Features {
+		fmt.Printf("- %-30s : %3d%% (%d/%d plugins installed)\n", feature.Name, feature.Score, len(feature.Installed), len(feature.Plugins))
+		if len(feature.Missing) > 0 {
+			fmt.Printf("  %-30s   missing: %s\n", "", strings.Join(feature.Missing, ", "))
+		}
+		if _, err = identified.Add("feature", feature.Name); err != nil {
+			return
+		}
+	}
+	if len(suggestion.Features) == 0 {
+		fmt.Printf("No features installed at %d%% or more.\n", *c.minCoverage)
+	}
+
+	if len(suggestion.Unexplained) > 0 {
+		fmt.Print("\nPlugins not explained by features:\n==========\n")
+	}
+	for _, name := range suggestion.Unexplained {
+		fmt.Printf("- %s\n", name)
+		identified.AddElement(elements.GetElement("plugin", name))
+	}
+
+	fmt.Printf("\nCoverage: %d/%d installed plugins explained by features (%d%%). %d top plugin(s) remain.\n",
+		len(suggestion.Explained), suggestion.Total, suggestion.Score(), len(suggestion.Unexplained))
+	return
+}
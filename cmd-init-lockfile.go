@@ -17,6 +17,7 @@ type cmdInitLockfile struct {
 	lockFile         *string
 	featureRepoPath  *string
 	featureRepoURL   *string
+	featureRepoRef   *string
 }
 
 func (c *cmdInitLockfile) init(parent *kingpin.CmdClause) {
@@ -26,7 +27,8 @@ func (c *cmdInitLockfile) init(parent *kingpin.CmdClause) {
 	c.lockFile = c.cmd.Flag("lock-file", "Full path to the lock file.").Default(lockFileName).String()
 	c.featureRepoPath = c.cmd.Flag("features-repo-path", "Path to a feature repository. "+
 		"By default, jplugins store the repo clone in jplugins cache directory.").Default(defaultFeaturesRepoPath).String()
-	c.featureRepoURL = c.cmd.Flag("features-repo-url", "URL to the feature repository. NOT IMPLEMENTED").Default(defaultFeaturesRepoURL).String()
+	c.featureRepoURL = c.cmd.Flag("features-repo-url", "URL to the feature repository.").Default(defaultFeaturesRepoURL).String()
+	c.featureRepoRef = c.cmd.Flag("features-repo-ref", "Branch, tag or commit ID of the feature repository to checkout.").String()
 
 }
 
@@ -54,7 +56,11 @@ func (c *cmdInitLockfile) DoInitLockfile() {
 		lockData.ImportInstalled(elements)
 	}
 
-	if !App.readFeatures(*c.featureRepoPath, *c.sourceFile, *c.featureRepoURL, lockData) {
+	if !App.readFeatures(*c.featureRepoPath, *c.sourceFile, *c.featureRepoURL, *c.featureRepoRef, lockData) {
+		os.Exit(1)
+	}
+
+	if !App.addFeaturesFileSource(*c.lockFile, *c.sourceFile, lockData) {
 		os.Exit(1)
 	}
 
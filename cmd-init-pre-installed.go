@@ -0,0 +1,37 @@
+package main
+
+import (
+	core "jplugins/coremgt"
+	"os"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/forj-oss/forjj-modules/trace"
+)
+
+type cmdInitPreInstalled struct {
+	cmd              *kingpin.CmdClause
+	warFile          *string
+	preInstalledPath *string
+}
+
+func (c *cmdInitPreInstalled) init(parent *kingpin.CmdClause) {
+	c.cmd = parent.Command("pre-installed", "Initialize the 'jplugins-preinstalled.lst' from plugins bundled and detached in the Jenkins war.")
+	c.warFile = c.cmd.Flag("war", "Path to the Jenkins war.").Required().String()
+	c.preInstalledPath = c.cmd.Flag("pre-installed-path", "Path where the pre-installed.lst file is written.").Default(".").String()
+}
+
+// DoInitPreInstalled write the list of plugins installed by the Jenkins war at first startup.
+func (c *cmdInitPreInstalled) DoInitPreInstalled() {
+	elements, err := core.ReadWarPlugins(*c.warFile)
+	if err != nil {
+		gotrace.Error("%s", err)
+		os.Exit(1)
+	}
+	if elements.Length() == 0 {
+		gotrace.Warning("No bundled or detached plugins found in '%s'.", *c.warFile)
+	}
+
+	if !App.saveVersionAsPreInstalled(*c.preInstalledPath, elements) {
+		os.Exit(1)
+	}
+}
@@ -8,10 +8,12 @@ type cmdInit struct {
 	cmd              *kingpin.CmdClause
 	lockfile         cmdInitLockfile
 	features         cmdInitFeatures
+	preInstalled     cmdInitPreInstalled
 }
 
 func (c *cmdInit) init() {
 	c.cmd = App.app.Command("init", "Initialize files to use jplugins.")
 	c.lockfile.init(c.cmd)
 	c.features.init(c.cmd)
+	c.preInstalled.init(c.cmd)
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"time"
 	core "jplugins/coremgt"
 
 	"github.com/alecthomas/kingpin"
@@ -15,10 +16,37 @@ type cmdInstall struct {
 	lockFile        *string
 	featureRepoPath *string
 	featureRepoURL  *string
+	featureRepoRef  *string
 	jenkinsHomePath *string
+	warPath         *string
+	warNoChecksum   *bool
+	fromBundle      *string
+	strict          *bool
+	backupPath      *string
+	backups         *int
+	jobs            *int
+	cachePath       *string
+	cacheMaxSize    *int
+	noCache         *bool
+	retries         *int
+	retryBackoff    *time.Duration
+	downloadTimeout *time.Duration
+	dryRun          *bool
+	format          *string
 }
 
 func (c *cmdInstall) doInstall() {
+	downloadConfig := core.DefaultDownloadConfig()
+	downloadConfig.Retries = *c.retries
+	downloadConfig.Backoff = *c.retryBackoff
+	downloadConfig.Timeout = *c.downloadTimeout
+	core.SetDownloadConfig(downloadConfig)
+
+	if *c.fromBundle != "" {
+		c.installBundle()
+		return
+	}
+
 	App.repository = core.NewRepository()
 	repo := App.repository
 	if !repo.LoadFromURL() {
@@ -35,6 +63,28 @@ func (c *cmdInstall) doInstall() {
 		elements = e
 	}
 
+	fromFeatures := len(elements.GetElements("groovy")) + len(elements.GetElements("casc")) + len(elements.GetElements("file"))
+	if fromFeatures > 0 && !App.prepareFeaturesRepo(*c.featureRepoPath, *c.featureRepoURL, *c.featureRepoRef) {
+		os.Exit(1)
+	}
+
+	if !App.checkLockSources(*c.lockFile, *c.featureRepoPath, *c.strict) {
+		os.Exit(1)
+	}
+
+	if errors := elements.CheckJenkinsCore(); len(errors) > 0 {
+		for _, err := range errors {
+			gotrace.Error("%s", err)
+		}
+		gotrace.Error("Plugins locked require a newer Jenkins core than '%s'. Process aborted.", elements.JenkinsCore())
+		os.Exit(1)
+	}
+
+	if *c.dryRun {
+		c.printPlan(core.NewJenkinsHome(*c.jenkinsHomePath), elements)
+		return
+	}
+
 	var savedBranch string
 
 	git.RunInPath(*c.featureRepoPath, func() error {
@@ -48,9 +98,89 @@ func (c *cmdInstall) doInstall() {
 	})
 
 	jenkinsHome := core.NewJenkinsHome(*c.jenkinsHomePath)
+	jenkinsHome.SetBackup(*c.backupPath, *c.backups)
+	jenkinsHome.SetLockFile(*c.lockFile)
+	jenkinsHome.SetJobs(*c.jobs)
+	jenkinsHome.SetCache(App.pluginsCache(*c.cachePath, *c.cacheMaxSize, *c.noCache))
+
+	// The war is downloaded and verified first, and replaced only if the Jenkins home install succeeds.
+	warDownloaded, ok := c.downloadWar(elements)
+	if !ok {
+		os.Exit(1)
+	}
 
 	if err := jenkinsHome.Install(elements, *c.featureRepoPath) ; err != nil {
+		if warDownloaded != "" {
+			os.Remove(warDownloaded)
+		}
 		gotrace.Error("%s. Process aborted.", err)
 		os.Exit(1)
 	}
+
+	if *c.warPath != "" {
+		if err := elements.JenkinsCore().InstallWar(warDownloaded, *c.warPath); err != nil {
+			gotrace.Error("%s", err)
+			os.Exit(1)
+		}
+		if warDownloaded == "" {
+			gotrace.Info("Jenkins %s war is up to date.", elements.JenkinsCore().Version)
+		} else {
+			gotrace.Info("Jenkins %s war installed in '%s'.", elements.JenkinsCore().Version, *c.warPath)
+		}
+	}
+}
+
+// installBundle install the Jenkins home from a bundle, with no network access.
+func (c *cmdInstall) installBundle() {
+	if *c.dryRun || *c.warPath != "" {
+		gotrace.Error("--dry-run and --war-path cannot be used with --from-bundle.")
+		os.Exit(1)
+	}
+
+	jenkinsHome := core.NewJenkinsHome(*c.jenkinsHomePath)
+	jenkinsHome.SetBackup(*c.backupPath, *c.backups)
+	if err := jenkinsHome.InstallBundle(*c.fromBundle); err != nil {
+		gotrace.Error("%s. Process aborted.", err)
+		os.Exit(1)
+	}
+}
+
+// downloadWar download the Jenkins war locked, if requested by --war-path.
+// It returns the file downloaded. Empty if not requested or already up to date.
+func (c *cmdInstall) downloadWar(elements *core.ElementsType) (downloaded string, _ bool) {
+	if *c.warPath == "" {
+		return "", true
+	}
+	jenkinsCore := elements.JenkinsCore()
+	if jenkinsCore == nil {
+		gotrace.Error("No Jenkins core locked in '%s'. Add 'jenkins:<version>' to the features file to install the war.", *c.lockFile)
+		return
+	}
+	if *c.warNoChecksum {
+		jenkinsCore.SetNoChecksum()
+	}
+	downloaded, err := jenkinsCore.DownloadWar(*c.warPath)
+	if err != nil {
+		gotrace.Error("%s. Process aborted.", err)
+		return
+	}
+	return downloaded, true
+}
+
+// printPlan display what the install would do on the Jenkins home, without changing it.
+func (c *cmdInstall) printPlan(jenkinsHome *core.JenkinsHome, elements *core.ElementsType) {
+	plan, err := jenkinsHome.Plan(elements, *c.featureRepoPath)
+	if err != nil {
+		gotrace.Error("Unable to compute the install plan. %s", err)
+		os.Exit(1)
+	}
+
+	if *c.format == jsonFormat {
+		if err := plan.PrintJSON(os.Stdout); err != nil {
+			gotrace.Error("%s", err)
+			os.Exit(1)
+		}
+		return
+	}
+	plan.PrintText(os.Stdout)
 }
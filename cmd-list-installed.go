@@ -11,10 +11,14 @@ type cmdListInstalled struct {
 	cmd             *kingpin.CmdClause
 	jenkinsHomePath *string
 	preInstalled    *bool
+	jenkinsURL      *string
+	jenkinsUser     *string
+	jenkinsToken    *string
 }
 
 func (c *cmdListInstalled) doListInstalled() {
 	App.setJenkinsHome(*c.jenkinsHomePath)
+	App.setJenkinsURL(*c.jenkinsURL, *c.jenkinsUser, *c.jenkinsToken)
 	elements, err := App.readFromJenkins()
 	if err != nil {
 		gotrace.Error("%s", err)
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	core "jplugins/coremgt"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/forj-oss/forjj-modules/trace"
+)
+
+type cmdMergeLock struct {
+	cmd          *kingpin.CmdClause
+	baseFile     *string
+	oursFile     *string
+	theirsFile   *string
+	output       *string
+	noDepsChecks *bool
+}
+
+func (c *cmdMergeLock) init() {
+	c.cmd = App.app.Command("merge-lock", "Three-way merge of lock files. Usable as git merge driver: 'jplugins merge-lock %O %A %B'.")
+	c.baseFile = c.cmd.Arg("base", "Lock file of the common ancestor.").Required().String()
+	c.oursFile = c.cmd.Arg("ours", "Our lock file version. Replaced by the merged lock file, except if --output is set.").Required().String()
+	c.theirsFile = c.cmd.Arg("theirs", "Their lock file version.").Required().String()
+	c.output = c.cmd.Flag("output", "Path to the merged lock file. By default, 'ours' file is replaced.").String()
+	c.noDepsChecks = c.cmd.Flag("no-deps-check", "Do not verify plugins dependencies minimum versions against the updates repository.").Bool()
+}
+
+// doMergeLock merge the 3 lock files versions and exit 1 if conflicts are found.
+// The merged file is written in any case, with conflicts marked at the end of the file.
+func (c *cmdMergeLock) doMergeLock() {
+	sides := make([]*core.ElementsType, 3)
+	for index, file := range []string{*c.baseFile, *c.oursFile, *c.theirsFile} {
+		elements, err := App.readElementsFromSource(file)
+		if err != nil {
+			gotrace.Error("%s", err)
+			os.Exit(1)
+		}
+		sides[index] = elements
+	}
+
+	merge := core.NewLockMerge(sides[0], sides[1], sides[2])
+	_, conflicts := merge.Merge()
+
+	if !*c.noDepsChecks {
+		App.repository = core.NewRepository()
+		repo := App.repository
+		if !repo.LoadFromURL() {
+			os.Exit(1)
+		}
+		conflicts = merge.CheckDependencies(repo)
+	}
+
+	output := *c.output
+	if output == "" {
+		output = *c.oursFile
+	}
+	if err := merge.WriteLock(output); err != nil {
+		gotrace.Error("Unable to save the merged lock file. %s", err)
+		os.Exit(1)
+	}
+
+	if len(conflicts) > 0 {
+		for _, conflict := range conflicts {
+			fmt.Fprintf(os.Stderr, "CONFLICT: %s\n", conflict)
+		}
+		gotrace.Error("%d conflict(s) found. Please fix '%s' manually.", len(conflicts), output)
+		os.Exit(1)
+	}
+	gotrace.Info("%s merged.", output)
+}
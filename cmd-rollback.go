@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	core "jplugins/coremgt"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/forj-oss/forjj-modules/trace"
+)
+
+type cmdRollback struct {
+	cmd             *kingpin.CmdClause
+	jenkinsHomePath *string
+	backupPath      *string
+	to              *string
+	list            *bool
+}
+
+func (c *cmdRollback) init() {
+	c.cmd = App.app.Command("rollback", "Restore plugins, groovies and files replaced by the latest install, or by all installs since a snapshot.")
+	c.jenkinsHomePath = c.cmd.Flag("jenkins-home", "Where Jenkins is installed.").Default(defaultJenkinsHome).String()
+	c.backupPath = c.cmd.Flag("backup-path", "Directory where snapshots are saved. "+
+		"By default, '.jplugins-backups' in the Jenkins home.").String()
+	c.to = c.cmd.Flag("to", "Snapshot to restore. All installs done since this snapshot are undone. By default, the latest one.").String()
+	c.list = c.cmd.Flag("list", "List snapshots available, oldest first.").Bool()
+}
+
+// doRollback restore a snapshot in the Jenkins home, or list snapshots available.
+func (c *cmdRollback) doRollback() {
+	jenkinsHome := core.NewJenkinsHome(*c.jenkinsHomePath)
+	jenkinsHome.SetBackup(*c.backupPath, core.DefaultBackups)
+
+	if *c.list {
+		snapshots, err := jenkinsHome.Snapshots()
+		if err != nil {
+			gotrace.Error("%s", err)
+			os.Exit(1)
+		}
+		for _, snapshot := range snapshots {
+			fmt.Println(snapshot)
+		}
+		fmt.Printf("\n%d snapshot(s) in %s\n", len(snapshots), jenkinsHome.BackupPath())
+		return
+	}
+
+	restored, err := jenkinsHome.Rollback(*c.to)
+	if err != nil {
+		gotrace.Error("%s. Process aborted.", err)
+		os.Exit(1)
+	}
+	for _, snapshot := range restored {
+		gotrace.Info("Snapshot '%s' restored.", snapshot)
+	}
+}
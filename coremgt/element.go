@@ -40,6 +40,8 @@ func NewElement(elementType string) (_ Element) {
 		return NewFeature()
 	case "groovy":
 		return NewGroovy()
+	case cascType, fileType:
+		return NewFeatureFile(elementType)
 	}
 	return
 }
\ No newline at end of file
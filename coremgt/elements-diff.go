@@ -0,0 +1,253 @@
+package coremgt
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	diffAdded      = "added"
+	diffRemoved    = "removed"
+	diffUpgraded   = "upgraded"
+	diffDowngraded = "downgraded"
+	diffChanged    = "changed" // Used for groovies, as commit IDs cannot be ordered.
+	diffUnchanged  = "unchanged"
+)
+
+// ElementDiff describes the difference of one element between 2 lists.
+type ElementDiff struct {
+	Type       string `json:"type"`
+	Name       string `json:"name"`
+	OldVersion string `json:"old_version,omitempty"`
+	NewVersion string `json:"new_version,omitempty"`
+	Status     string `json:"status"`
+}
+
+// ElementsDiff stores the differences between 2 elements lists (lock files, pre-installed lists, ...)
+type ElementsDiff struct {
+	Old     string        `json:"old"`
+	New     string        `json:"new"`
+	Changes []ElementDiff `json:"changes"`
+}
+
+// NewElementsDiff compare 2 elements lists and categorize each element as added, removed, upgraded or downgraded.
+// Unchanged elements are not kept.
+func NewElementsDiff(oldName string, oldList *ElementsType, newName string, newList *ElementsType) (ret *ElementsDiff) {
+	ret = new(ElementsDiff)
+	ret.Old = oldName
+	ret.New = newName
+	ret.Changes = make([]ElementDiff, 0, 16)
+
+	for _, elementType := range []string{pluginType, groovyType, cascType, fileType} {
+		oldElements := oldList.GetElements(elementType)
+		newElements := newList.GetElements(elementType)
+
+		for name, oldElement := range oldElements {
+			diff := ElementDiff{
+				Type:       elementType,
+				Name:       name,
+				OldVersion: elementVersionString(oldElement),
+			}
+			if newElement, found := newElements[name]; found {
+				diff.NewVersion = elementVersionString(newElement)
+				diff.Status = compareElementVersions(elementType, diff.OldVersion, diff.NewVersion)
+			} else {
+				diff.Status = diffRemoved
+			}
+			if diff.Status != diffUnchanged {
+				ret.Changes = append(ret.Changes, diff)
+			}
+		}
+		for name, newElement := range newElements {
+			if _, found := oldElements[name]; found {
+				continue
+			}
+			ret.Changes = append(ret.Changes, ElementDiff{
+				Type:       elementType,
+				Name:       name,
+				NewVersion: elementVersionString(newElement),
+				Status:     diffAdded,
+			})
+		}
+	}
+
+	sort.Slice(ret.Changes, func(i, j int) bool {
+		if ret.Changes[i].Type != ret.Changes[j].Type {
+			// plugins first, then groovies.
+			return ret.Changes[i].Type == pluginType
+		}
+		return ret.Changes[i].Name < ret.Changes[j].Name
+	})
+
+	// The Jenkins core is reported first.
+	if diff, changed := coreDiff(oldList.JenkinsCore(), newList.JenkinsCore()); changed {
+		ret.Changes = append([]ElementDiff{diff}, ret.Changes...)
+	}
+	return
+}
+
+// coreDiff compare 2 Jenkins cores locked. changed is false if both are identical or not locked.
+func coreDiff(oldCore, newCore *JenkinsCore) (diff ElementDiff, changed bool) {
+	diff = ElementDiff{Type: jenkinsType, Name: jenkinsType}
+	if oldCore != nil {
+		diff.OldVersion = oldCore.Version
+	}
+	if newCore != nil {
+		diff.NewVersion = newCore.Version
+	}
+	switch {
+	case diff.OldVersion == diff.NewVersion:
+		return diff, false
+	case diff.OldVersion == "":
+		diff.Status = diffAdded
+	case diff.NewVersion == "":
+		diff.Status = diffRemoved
+	default:
+		diff.Status = compareElementVersions(pluginType, diff.OldVersion, diff.NewVersion)
+	}
+	return diff, true
+}
+
+// HasChanges return true if at least one element differs.
+func (d *ElementsDiff) HasChanges() bool {
+	return d != nil && len(d.Changes) > 0
+}
+
+// Count return the number of changes with the given status.
+func (d *ElementsDiff) Count(status string) (total int) {
+	if d == nil {
+		return
+	}
+	for _, change := range d.Changes {
+		if change.Status == status {
+			total++
+		}
+	}
+	return
+}
+
+// PrintText display the differences as a text table.
+func (d *ElementsDiff) PrintText(out io.Writer) {
+	if d == nil {
+		return
+	}
+	fmt.Fprintf(out, "Comparing %s => %s\n", d.Old, d.New)
+	if !d.HasChanges() {
+		fmt.Fprintln(out, "No differences found.")
+		return
+	}
+
+	iMaxName := 0
+	for _, change := range d.Changes {
+		if size := len(change.Type) + len(change.Name) + 1; size > iMaxName {
+			iMaxName = size
+		}
+	}
+	nameFormat := "%-10s %-" + strconv.Itoa(iMaxName) + "s : "
+	for _, change := range d.Changes {
+		fmt.Fprintf(out, nameFormat, change.Status, change.Type+":"+change.Name)
+		switch change.Status {
+		case diffAdded:
+			fmt.Fprintf(out, "%s\n", change.NewVersion)
+		case diffRemoved:
+			fmt.Fprintf(out, "%s\n", change.OldVersion)
+		default:
+			fmt.Fprintf(out, "%s => %s\n", change.OldVersion, change.NewVersion)
+		}
+	}
+	fmt.Fprintf(out, "\n%s\n", d.summary())
+}
+
+// PrintMarkdown display the differences as a GitHub flavoured markdown table, to be used as PR comment.
+func (d *ElementsDiff) PrintMarkdown(out io.Writer) {
+	if d == nil {
+		return
+	}
+	fmt.Fprintf(out, "### jplugins changes: `%s` => `%s`\n\n", d.Old, d.New)
+	if !d.HasChanges() {
+		fmt.Fprintln(out, "No differences found.")
+		return
+	}
+
+	fmt.Fprintln(out, "| Status | Type | Name | Old | New |")
+	fmt.Fprintln(out, "|--------|------|------|-----|-----|")
+	for _, change := range d.Changes {
+		fmt.Fprintf(out, "| %s | %s | %s | %s | %s |\n", change.Status, change.Type, change.Name,
+			markdownCode(change.OldVersion), markdownCode(change.NewVersion))
+	}
+	fmt.Fprintf(out, "\n%s\n", d.summary())
+}
+
+// PrintJSON display the differences as JSON data.
+func (d *ElementsDiff) PrintJSON(out io.Writer) error {
+	if d == nil {
+		return nil
+	}
+	jsonData, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Unable to encode in JSON. %s", err)
+	}
+	_, err = fmt.Fprintln(out, string(jsonData))
+	return err
+}
+
+/************************************************************************
+ ***************** INTERNAL FUNCTIONS ***********************************
+ ************************************************************************/
+
+func (d *ElementsDiff) summary() string {
+	counts := make([]string, 0, 5)
+	for _, status := range []string{diffAdded, diffRemoved, diffUpgraded, diffDowngraded, diffChanged} {
+		if count := d.Count(status); count > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", count, status))
+		}
+	}
+	return fmt.Sprintf("%d change(s): %s.", len(d.Changes), strings.Join(counts, ", "))
+}
+
+// elementVersionString return the version of a plugin or the commit ID of a groovy.
+func elementVersionString(element Element) string {
+	switch e := element.(type) {
+	case *Plugin:
+		return e.Version
+	case *Groovy:
+		return e.CommitID
+	case *FeatureFile:
+		return e.CommitID
+	}
+	version, _ := element.GetVersion()
+	return version.String()
+}
+
+// compareElementVersions identify the kind of change between 2 versions
+func compareElementVersions(elementType, oldVersion, newVersion string) string {
+	if oldVersion == newVersion {
+		return diffUnchanged
+	}
+	if elementType != pluginType {
+		return diffChanged
+	}
+
+	var v1, v2 VersionStruct
+	if v1.Set(oldVersion) != nil || v2.Set(newVersion) != nil || v1.Get() == nil || v2.Get() == nil {
+		return diffChanged
+	}
+	switch v1.Get().Compare(v2.Get()) {
+	case -1:
+		return diffUpgraded
+	case 1:
+		return diffDowngraded
+	}
+	return diffUnchanged
+}
+
+func markdownCode(value string) string {
+	if value == "" {
+		return ""
+	}
+	return "`" + value + "`"
+}
@@ -26,9 +26,14 @@ type ElementsType struct {
 
 	repoPath       string
 	repoURL        []*url.URL
+	repoRef        string
 	useLocal       bool
+	featuresRepo   *FeaturesRepo
+	featuresRepos  *featuresRepos
 	noDeps         bool
 	supportContext map[string]map[string]string
+	core           *JenkinsCore // Jenkins core locked. (`jenkins:<version>:<sha256>`)
+	sources        *LockSources // Sources hashes of the lock file. (`lst:...`, `desc:...`)
 
 	ref *Repository
 }
@@ -39,6 +44,8 @@ func NewElementsType() (ret *ElementsType) {
 	ret.list = make(map[string]Elements)
 	ret.supported = []string{featureType, groovyType, pluginType}
 	ret.supportContext = make(map[string]map[string]string)
+	ret.featuresRepos = newFeaturesRepos()
+	ret.sources = NewLockSources()
 	ret.noDeps = false
 	return
 }
@@ -51,8 +58,9 @@ func (e *ElementsType) SetRepository(ref *Repository) {
 	e.ref = ref
 }
 
-// noRecursiveChainLoaded
-func (e *ElementsType) noRecursiveChain() {
+// NoRecursiveChain disable dependencies loading when elements are added.
+// Useful to load a list of elements (like a lock file) without any updates repository.
+func (e *ElementsType) NoRecursiveChain() {
 	if e == nil {
 		return
 	}
@@ -254,6 +262,23 @@ func (e *ElementsType) SetFeaturesRepoURL(repoURL string) error {
 	return nil
 }
 
+// AddFeaturesRepo register a named features repository. (`repo:<name>:<url>`)
+// Features of this repository are referenced as `feature:<name>/<feature>`
+func (e *ElementsType) AddFeaturesRepo(name, repoURL string) error {
+	if e == nil {
+		return nil
+	}
+	return e.featuresRepos.add(name, repoURL)
+}
+
+// SetFeaturesRepoRef defines the branch, tag or commit ID of the features repository to checkout.
+func (e *ElementsType) SetFeaturesRepoRef(ref string) {
+	if e == nil {
+		return
+	}
+	e.repoRef = ref
+}
+
 // SetFeaturesPath defines where a features repository is located like `jenkins-install-inits`
 func (e *ElementsType) SetFeaturesPath(repoPath string) error {
 	if e == nil {
@@ -289,17 +314,52 @@ func (e *ElementsType) AddSupportContext(elementType, key, value string) {
 func (e *ElementsType) Read(file string, cols int) (err error) {
 	data := simplefile.NewSimpleFile(file, cols)
 
+	var conflictErr error
 	err = data.Read(":", func(fields []string) (err error) {
+		if isConflictMarker(fields[0]) {
+			conflictErr = fmt.Errorf("'%s' contains merge conflicts. Please fix them first", file)
+			return conflictErr
+		}
+		if fields[0] == repoType && len(fields) >= 3 {
+			return e.AddFeaturesRepo(fields[1], strings.Join(fields[2:], ":"))
+		}
+		if fields[0] == jenkinsType {
+			return e.setJenkinsCore(fields)
+		}
+		if e.sources.setFromFields(fields) {
+			return
+		}
 		_, err = e.Add(fields...)
 		return
 	})
+	if err == nil {
+		err = conflictErr
+	}
+	return
+}
+
+// ReadFeaturesRepos load only named features repositories (`repo:<name>:<url>`) from the file given.
+func (e *ElementsType) ReadFeaturesRepos(file string) (err error) {
+	data := simplefile.NewSimpleFile(file, 3)
+
+	var repoErr error
+	err = data.Read(":", func(fields []string) (_ error) {
+		if fields[0] != repoType || len(fields) < 3 || repoErr != nil {
+			return
+		}
+		repoErr = e.AddFeaturesRepo(fields[1], strings.Join(fields[2:], ":"))
+		return
+	})
+	if err == nil && repoErr != nil {
+		err = fmt.Errorf("Unable to read features repositories from '%s'. %s", file, repoErr)
+	}
 	return
 }
 
 // ExtractTopElements identifies top plugins (remove all dependencies)
 func (e *ElementsType) ExtractTopElements() (identified *ElementsType) {
 	identified = NewElementsType()
-	identified.noRecursiveChain()
+	identified.NoRecursiveChain()
 
 	plugins := e.list[pluginType]
 	for _, plugin := range plugins {
@@ -321,16 +381,48 @@ func (e *ElementsType) ExtractTopElements() (identified *ElementsType) {
 
 // WriteSimple the list of plugins as Simple format
 func (e *ElementsType) WriteSimple(file string, cols int) (err error) {
-	featureFile := simplefile.NewSimpleFile(file, 2)
+	featureFile := simplefile.NewSimpleFile(file, 4)
 	for elementType, plugins := range e.list {
-		for name := range plugins {
-			featureFile.AddWithKeyIndex(1, elementType, name)
+		for name, element := range plugins {
+			fields := []string{elementType, name}
+			// Plugin states are kept, with no version constraint. (`plugin:<name>::disabled`)
+			if plugin, ok := element.(*Plugin); ok && len(plugin.states) > 0 {
+				fields = append(fields, "", plugin.StatesString())
+			}
+			// Keyed by type, so features are written first and never collide with a plugin of the same name.
+			featureFile.AddWithKeyString(elementType+":"+name, fields...)
 		}
 	}
 	err = featureFile.WriteSorted(":")
 	return
 }
 
+// WriteLock save the list of plugins, groovies and feature files in the lock file format
+func (e *ElementsType) WriteLock(file string) (err error) {
+	lockFile := simplefile.NewSimpleFile(file, 5)
+
+	for name, element := range e.list[pluginType] {
+		lockFile.AddWithKeyString("1-"+name, lockFields(pluginType, name, element)...)
+	}
+	for name, element := range e.list[groovyType] {
+		lockFile.AddWithKeyString("2-"+name, lockFields(groovyType, name, element)...)
+	}
+	for _, elementType := range []string{cascType, fileType} {
+		for name, element := range e.list[elementType] {
+			lockFile.AddWithKeyString("3-"+elementType+"-"+name, lockFields(elementType, name, element)...)
+		}
+	}
+	e.featuresRepos.addToLockFile(lockFile)
+	e.core.addToLockFile(lockFile)
+	e.sources.addToLockFile(lockFile)
+
+	err = lockFile.WriteSorted(":")
+	if err != nil {
+		err = fmt.Errorf("Unable to write '%s'. %s", file, err)
+	}
+	return
+}
+
 // Length the list of plugins as Simple format
 func (e *ElementsType) Length() (total int) {
 	for _, elements := range e.list {
@@ -451,6 +543,63 @@ func (e *ElementsType) setElementsRequiredVersion(element Element, elements map[
 	}
 }
 
+// getFeaturesRepo return the features repository requested, cloned or updated if not local. It is done only once.
+// The default repository has an empty name. Named repositories are cloned in the jplugins cache directory.
+func (e *ElementsType) getFeaturesRepo(repoName string) (repo *FeaturesRepo, err error) {
+	if repoName != "" {
+		if repo, err = e.featuresRepos.get(repoName); err != nil {
+			return
+		}
+		return repo, repo.Prepare()
+	}
+
+	if e.featuresRepo == nil {
+		e.featuresRepo = NewFeaturesRepo(e.repoPath)
+		if len(e.repoURL) > 0 {
+			e.featuresRepo.SetURL(e.repoURL[0].String())
+		}
+		e.featuresRepo.SetRef(e.repoRef)
+		if e.useLocal {
+			e.featuresRepo.SetLocal()
+		}
+	}
+	return e.featuresRepo, e.featuresRepo.Prepare()
+}
+
+// lockFields return the lock file record fields of an element. nil if the element cannot be locked.
+func lockFields(elementType, name string, element Element) (fields []string) {
+	switch element := element.(type) {
+	case *FeatureFile:
+		return element.lockFields()
+	case *Plugin:
+		fields = []string{elementType, name, elementVersionString(element)}
+		if len(element.states) > 0 {
+			fields = append(fields, element.StatesString())
+		}
+	case *Groovy:
+		fields = []string{elementType, name, elementVersionString(element)}
+		if element.repoName != "" {
+			fields = append(fields, element.repoName)
+		}
+	default:
+		if elementType == cascType || elementType == fileType {
+			return
+		}
+		fields = []string{elementType, name, elementVersionString(element)}
+	}
+	return
+}
+
+// isConflictMarker return true if the line starts with a GIT conflict marker, as written by `jplugins merge-lock`.
+func isConflictMarker(line string) bool {
+	for _, marker := range []string{"<<<<<<<", "=======", ">>>>>>>"} {
+		if strings.HasPrefix(line, marker) {
+			return true
+		}
+	}
+	return false
+}
+
 func (e *ElementsType) checkElementType(elementType string) (found bool) {
 	for _, value := range e.supported {
 		if value == elementType {
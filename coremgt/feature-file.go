@@ -0,0 +1,248 @@
+package coremgt
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/forj-oss/forjj-modules/trace"
+	goversion "github.com/hashicorp/go-version"
+)
+
+const (
+	cascType = "casc"
+	fileType = "file"
+)
+
+// FeatureFile describe a file delivered by a feature and installed in the Jenkins home.
+//
+// In a feature descriptor:
+// - `casc:<file>` installs the feature file in `casc_configs/` (Jenkins Configuration as Code)
+// - `file:<src>:<dest>` installs the feature file as <dest>, relative to the Jenkins home.
+//
+// In a lock file, the file is recorded with the commit ID, the features repository name and the destination:
+// `<casc|file>:[<repo>/]<feature>/<src>:<commit>:[<repo>]:<dest>`
+type FeatureFile struct {
+	fileType      string
+	name          string
+	Dest          string
+	CommitID      string
+	Md5           string
+	commitHistory []string
+
+	featureName string
+	repoName    string // Features repository name. Empty for the default one.
+	featureRef  string // Commit ID the feature is pinned to. Empty to use the repository HEAD.
+}
+
+// NewFeatureFile return a FeatureFile object of the type given (casc or file)
+func NewFeatureFile(elementType string) (ret *FeatureFile) {
+	ret = new(FeatureFile)
+	ret.fileType = elementType
+	return
+}
+
+// String return the string representation of the file
+func (p *FeatureFile) String() string {
+	if p == nil {
+		return "nil"
+	}
+	return fmt.Sprintf("%s:%s %s => %s", p.fileType, p.name, p.CommitID, p.Dest)
+}
+
+// GetVersion return an empty Version struct. A file is versioned by commit ID.
+func (p *FeatureFile) GetVersion() (_ VersionStruct, _ error) {
+	return
+}
+
+// SetFrom set data from an array of fields
+// 2 (casc) or 3 (file) fields are read from a feature descriptor. 4 fields or more are read from a lock file.
+func (p *FeatureFile) SetFrom(fields ...string) (err error) {
+	fieldsSize := len(fields)
+	if fieldsSize < 2 {
+		err = fmt.Errorf("Invalid data type. Requires type (field 1) as '%s' or '%s' and file name (field 2)", cascType, fileType)
+		return
+	}
+	if fields[0] != cascType && fields[0] != fileType {
+		err = fmt.Errorf("Invalid data type. Must be '%s' or '%s'", cascType, fileType)
+		return
+	}
+	p.fileType = fields[0]
+	p.name = fields[1]
+
+	switch {
+	case fieldsSize >= 4:
+		p.CommitID = fields[2]
+		p.repoName = fields[3]
+		if fieldsSize >= 5 {
+			p.Dest = fields[4]
+		}
+	case fieldsSize == 3 && p.fileType == fileType:
+		p.Dest = fields[2]
+	case fieldsSize == 3:
+		p.CommitID = fields[2]
+	}
+
+	if p.Dest == "" && p.fileType == cascType {
+		p.Dest = path.Join(jenkinsHomeCascPath, path.Base(p.name))
+	}
+	if p.Dest == "" {
+		return fmt.Errorf("Invalid '%s:%s'. Requires a destination. Expect '%s:<src>:<dest>'", p.fileType, p.name, fileType)
+	}
+	return checkFileDest(p.Dest)
+}
+
+// CompleteFromContext define the file version (commit ID) and md5sum from the feature context.
+func (p *FeatureFile) CompleteFromContext(context *ElementsType) (err error) {
+	if context == nil {
+		return
+	}
+	v, found := context.supportContext[p.fileType]
+	if !found {
+		gotrace.Error("Invalid %s file reference. It must be defined by feature. supportContext is nil or not defined for '%s', thus missing 'featureName'.", p.fileType, p.fileType)
+		return
+	}
+	if p.featureName, found = v["featureName"]; !found {
+		gotrace.Error("Invalid %s file reference. It must be defined by feature. supportContext['featureName'] not defined.", p.fileType)
+		return
+	}
+	p.repoName = v["repoName"]
+	p.featureRef = v["featureRef"]
+
+	sourcePath := path.Join(context.repoPath, p.featureName)
+
+	if p.commitHistory == nil {
+		if p.commitHistory, err = gitFileHistory(sourcePath, p.featureRef, p.name); err != nil {
+			return fmt.Errorf("Unable to define the %s file '%s' version (commit ID)> %s", p.fileType, p.name, err)
+		}
+	}
+	if len(p.commitHistory) == 0 {
+		return fmt.Errorf("%s file '%s' is not found in feature '%s'", p.fileType, p.name, p.featureName)
+	}
+	p.CommitID = p.commitHistory[0]
+
+	p.Md5, err = fileMd5(sourcePath, p.CommitID, p.name)
+	return
+}
+
+// RepoName return the features repository name of the file. Empty for the default features repository.
+func (p *FeatureFile) RepoName() string {
+	return p.repoName
+}
+
+// GetType return the internal type string
+func (p *FeatureFile) GetType() string {
+	return p.fileType
+}
+
+// Name return the Name property
+func (p *FeatureFile) Name() string {
+	return p.name
+}
+
+// ChainElement do nothing. A file has no dependency.
+func (p *FeatureFile) ChainElement(*ElementsType) (_ *ElementsType, _ error) {
+	return
+}
+
+// Merge do nothing.
+func (p *FeatureFile) Merge(_ *ElementsType, _ Element, _ int) (_ bool, _ error) {
+	return
+}
+
+// IsFixed indicates if the file version is fixed.
+func (p *FeatureFile) IsFixed() (_ bool) {
+	return
+}
+
+// GetParents return nothing.
+func (p *FeatureFile) GetParents() (_ Elements) {
+	return
+}
+
+// GetDependencies return nothing.
+func (p *FeatureFile) GetDependencies() (_ Elements) {
+	return
+}
+
+// GetDependenciesFromContext return nothing.
+func (p *FeatureFile) GetDependenciesFromContext(*ElementsType) (_ Elements) {
+	return
+}
+
+// SetVersionConstraintFromDepConstraint do nothing.
+func (p *FeatureFile) SetVersionConstraintFromDepConstraint(*ElementsType, Element) (_ error) {
+	return
+}
+
+// IsVersionCandidate return true systematically
+func (p *FeatureFile) IsVersionCandidate(version *goversion.Version) bool {
+	return true
+}
+
+func (p *FeatureFile) RemoveDependencyTo(depElement Element) {
+}
+
+func (p *FeatureFile) AddDependencyTo(depElement Element) {
+}
+
+func (p *FeatureFile) DefineLatestPossibleVersion(context *ElementsType) (_ error) {
+	return
+}
+
+func (p *FeatureFile) AsNewPluginsStatusDetails(context *ElementsType) (sd *pluginsStatusDetails) {
+	return
+}
+
+func (p *FeatureFile) AsNewGrooviesStatusDetails(context *ElementsType) (sd *GroovyStatusDetails) {
+	return
+}
+
+// asNewFileStatusDetails add the current file as a NEW file in status details
+func (p *FeatureFile) asNewFileStatusDetails(context *ElementsType) (sd *FileStatusDetails) {
+	name := p.name
+	if p.featureName != "" {
+		name = qualifiedName(p.repoName, path.Join(p.featureName, p.name))
+	}
+	sd = newFileStatusDetails(p.fileType, name, p.Dest, context.repoPath)
+	sd.repoName = p.repoName
+	sd.newMd5 = p.Md5
+	sd.newCommit = p.CommitID
+	return
+}
+
+// lockFields return the lock file record of the file
+func (p *FeatureFile) lockFields() []string {
+	return []string{p.fileType, p.name, p.CommitID, p.repoName, p.Dest}
+}
+
+// checkFileDest verify that the destination stays in the Jenkins home.
+func checkFileDest(dest string) error {
+	if path.IsAbs(dest) {
+		return fmt.Errorf("Invalid destination '%s'. Must be relative to the Jenkins home", dest)
+	}
+	if cleaned := path.Clean(dest); cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return fmt.Errorf("Invalid destination '%s'. Must be a file in the Jenkins home", dest)
+	}
+	return nil
+}
+
+// fileMd5 return the base64 md5sum of a file at the revision given.
+// The file path is relative to sourcePath. Without revision, the file is read from the working tree.
+func fileMd5(sourcePath, revision, file string) (_ string, err error) {
+	var data []byte
+	if revision != "" {
+		var content string
+		if content, err = gitShowFile(sourcePath, revision, file); err != nil {
+			return
+		}
+		data = []byte(content)
+	} else if data, err = ioutil.ReadFile(path.Join(sourcePath, file)); err != nil {
+		return "", fmt.Errorf("Unable to read '%s'. %s", path.Join(sourcePath, file), err)
+	}
+	hash := md5.Sum(data)
+	return base64.StdEncoding.EncodeToString(hash[:]), nil
+}
@@ -6,7 +6,6 @@ import (
 	"path"
 	"strings"
 
-	"github.com/forj-oss/go-git"
 	goversion "github.com/hashicorp/go-version"
 )
 
@@ -16,9 +15,11 @@ const (
 
 // Feature describe details on Feature.
 type Feature struct {
-	Version string
-	name    string
-	rules   map[string]goversion.Constraints
+	Version      string
+	name         string
+	rules        map[string]goversion.Constraints
+	parent       *Feature // Feature which includes this feature. nil for a top feature.
+	dependencies Elements // plugins, groovies and files declared by this feature.
 }
 
 // NewFeature return a feature object
@@ -59,6 +60,9 @@ func (p *Feature) SetFrom(fields ...string) (err error) {
 		return
 	}
 	p.name = fields[1]
+	if fieldsSize >= 3 {
+		p.Version = fields[2]
+	}
 	return
 }
 
@@ -83,38 +87,81 @@ func (p *Feature) ChainElement(context *ElementsType) (ret *ElementsType, _ erro
 		return
 	}
 
-	ret = NewElementsType()
-	ret.AddSupport(pluginType, groovyType)
-	ret.AddSupportContext(groovyType, "featureName", p.Name())
-	ret.SetFeaturesPath(context.repoPath)
-	ret.noRecursiveChain()
-	ret.SetRepository(context.ref)
-
-	if !context.useLocal {
-		return nil, fmt.Errorf("Git clone of repository not currently implemented. Do git task and use --features-repo-path")
+	repoName, featureName := SplitFeatureName(p.Name())
+	repo, err := context.getFeaturesRepo(repoName)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := git.RunInPath(context.repoPath, func() error {
-		if git.Do("rev-parse", "--git-dir") != 0 {
-			return fmt.Errorf("Not a valid GIT repository")
-		}
-		return nil
-	}); err != nil {
-		return nil, fmt.Errorf("Issue with '%s', %s", context.repoPath, err)
+	ret = NewElementsType()
+	ret.AddSupport(pluginType, groovyType, cascType, fileType, featureType)
+	for _, elementType := range []string{groovyType, cascType, fileType} {
+		ret.AddSupportContext(elementType, "featureName", featureName)
+		ret.AddSupportContext(elementType, "repoName", repoName)
 	}
+	ret.SetFeaturesPath(repo.Path())
+	ret.NoRecursiveChain()
+	ret.SetRepository(context.ref)
 
-	featureFile := path.Join(context.repoPath, p.Name(), p.Name()+".desc")
+	featureDesc := path.Join(featureName, featureName+".desc")
+	featureFile := path.Join(repo.Path(), featureDesc)
 
 	simpleFile := simplefile.NewSimpleFile(featureFile, 3)
 
-	err := simpleFile.Read(":", func(fields []string) (err error) {
-		_, err = ret.Add(fields...)
+	var commit string
+	nestedErrors := make([]string, 0)
+	addElement := func(fields []string) (err error) {
+		if fields[0] == featureType && len(fields) >= 2 {
+			if fields, err = p.nestedFeatureFields(context, repoName, commit, fields); err != nil {
+				nestedErrors = append(nestedErrors, err.Error())
+				return
+			}
+		}
+		var element Element
+		if element, err = ret.Add(fields...); err != nil {
+			return
+		}
+		if feature, ok := element.(*Feature); ok {
+			feature.parent = p
+		}
 		return
-	})
+	}
+
+	if p.Version != "" {
+		// Pinned feature: the desc file and groovies are read at the feature reference.
+		var data string
+		if commit, err = repo.ResolveRef(p.Version); err != nil {
+			return nil, fmt.Errorf("Unable to pin feature '%s'. %s", p.name, err)
+		}
+		for _, elementType := range []string{groovyType, cascType, fileType} {
+			ret.AddSupportContext(elementType, "featureRef", commit)
+		}
+		if data, err = repo.showFile(commit, featureDesc); err != nil {
+			return nil, fmt.Errorf("Unable to read feature file '%s'. %s", featureFile, err)
+		}
+		err = simpleFile.ReadData(data, ":", addElement)
+	} else {
+		err = simpleFile.Read(":", addElement)
+	}
 
 	if err != nil {
 		return nil, fmt.Errorf("Unable to read feature file '%s'. %s", featureFile, err)
 	}
+	if len(nestedErrors) > 0 {
+		return nil, fmt.Errorf("Unable to load features included by '%s'. %s", p.name, strings.Join(nestedErrors, ", "))
+	}
+	return
+}
+
+// IncludedBy return the list of features which includes this feature, from the top feature.
+func (p *Feature) IncludedBy() (chain []string) {
+	if p == nil {
+		return
+	}
+	chain = make([]string, 0, 2)
+	for parent := p.parent; parent != nil; parent = parent.parent {
+		chain = append([]string{parent.name}, chain...)
+	}
 	return
 }
 
@@ -135,9 +182,13 @@ func (p *Feature) GetParents() (_ Elements) {
 	return
 }
 
-// GetDependencies return the list of features depedencies required by this feature.
+// GetDependencies return the list of plugins and groovies declared by this feature.
+// Nested features are not listed. They refer to this feature as parent.
 func (p *Feature) GetDependencies() (_ Elements) {
-	return
+	if p == nil {
+		return
+	}
+	return p.dependencies
 }
 
 // GetDependenciesFromContext return the list of features depedencies required by this feature.
@@ -156,10 +207,23 @@ func (p *Feature) IsVersionCandidate(version *goversion.Version) bool {
 	return true
 }
 
+// RemoveDependencyTo remove the plugin or groovy from the feature declared elements.
 func (p *Feature) RemoveDependencyTo(depElement Element) {
+	if p == nil || depElement == nil || p.dependencies == nil {
+		return
+	}
+	delete(p.dependencies, depElement.Name())
 }
 
+// AddDependencyTo attribute a plugin or groovy to this feature.
 func (p *Feature) AddDependencyTo(depElement Element) {
+	if p == nil || depElement == nil || depElement.GetType() == featureType {
+		return
+	}
+	if p.dependencies == nil {
+		p.dependencies = make(Elements)
+	}
+	p.dependencies[depElement.Name()] = depElement
 }
 
 func (p *Feature) DefineLatestPossibleVersion(context *ElementsType) (_ error) {
@@ -173,3 +237,39 @@ func (p *Feature) AsNewPluginsStatusDetails(context *ElementsType) (sd *pluginsS
 func (p *Feature) AsNewGrooviesStatusDetails(context *ElementsType) (sd *GroovyStatusDetails) {
 	return
 }
+
+// nestedFeatureFields check and complete a `feature` line found in the feature descriptor.
+//
+// - A feature without repository prefix is searched in the repository of the including feature.
+// - A feature without reference inherits the including feature commit, if both are in the same repository.
+// - A feature including itself, directly or not, is reported as a cycle.
+// - A feature already loaded with another reference is reported as error.
+func (p *Feature) nestedFeatureFields(context *ElementsType, repoName, commit string, fields []string) (_ []string, err error) {
+	name := fields[1]
+	if nestedRepo, _ := SplitFeatureName(name); nestedRepo == "" {
+		name = qualifiedName(repoName, name)
+	}
+	ref := ""
+	if len(fields) >= 3 {
+		ref = fields[2]
+	} else if nestedRepo, _ := SplitFeatureName(name); nestedRepo == repoName {
+		ref = commit
+	}
+
+	for feature := p; feature != nil; feature = feature.parent {
+		if feature.name == name {
+			chain := append(p.IncludedBy(), p.name, name)
+			return nil, fmt.Errorf("Features cycle detected: %s", strings.Join(chain, " -> "))
+		}
+	}
+
+	if existing, ok := context.GetElement(featureType, name).(*Feature); ok && existing.Version != ref {
+		return nil, fmt.Errorf("Feature '%s' included at '%s' while already loaded at '%s'", name, ref, existing.Version)
+	}
+
+	fields = []string{featureType, name}
+	if ref != "" {
+		fields = append(fields, ref)
+	}
+	return fields, nil
+}
@@ -0,0 +1,193 @@
+package coremgt
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// FeatureInfo describe a feature found in a features repository.
+type FeatureInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// FeatureDetails is the expanded content of a feature: nested features, plugins (with dependencies), groovies and files.
+type FeatureDetails struct {
+	Name        string            `json:"name"`
+	Ref         string            `json:"ref,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Features    []string          `json:"features"`
+	Plugins     []*FeatureElement `json:"plugins"`
+	Groovies    []*FeatureElement `json:"groovies"`
+	Files       []*FeatureElement `json:"files"`
+}
+
+// FeatureElement is an element brought by a feature, with its resolved version.
+type FeatureElement struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Version string `json:"version"` // Plugin version or commit ID.
+	Dest    string `json:"dest,omitempty"`
+	Feature string `json:"feature,omitempty"` // Feature which declared it. Empty for a plugin dependency.
+}
+
+// ListFeatures return the sorted list of features found in the features repository path.
+// A feature is a directory with a `<feature>/<feature>.desc` file. The description is the header comment of the desc file.
+func ListFeatures(repoPath string) (features []FeatureInfo, err error) {
+	entries, err := ioutil.ReadDir(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the features repository '%s'. %s", repoPath, err)
+	}
+
+	features = make([]FeatureInfo, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		descFile := path.Join(repoPath, entry.Name(), entry.Name()+".desc")
+		data, err := ioutil.ReadFile(descFile)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return nil, fmt.Errorf("Unable to read '%s'. %s", descFile, err)
+			}
+			continue
+		}
+		features = append(features, FeatureInfo{Name: entry.Name(), Description: descHeader(string(data))})
+	}
+	return
+}
+
+// FeatureDetails load the feature given, with nested features, then return the expanded list of elements.
+// Plugins versions are resolved from the updates repository. The ElementsType must be configured with
+// the features repository and the updates repository.
+func (e *ElementsType) FeatureDetails(name, ref string) (details *FeatureDetails, err error) {
+	if e == nil {
+		return
+	}
+	fields := []string{featureType, name}
+	if ref != "" {
+		fields = append(fields, ref)
+	}
+	if _, err = e.Add(fields...); err != nil {
+		return nil, fmt.Errorf("Unable to load feature '%s'. %s", name, err)
+	}
+
+	details = new(FeatureDetails)
+	details.Name = name
+	details.Ref = ref
+	details.Features = make([]string, 0)
+	details.Plugins = make([]*FeatureElement, 0)
+	details.Groovies = make([]*FeatureElement, 0)
+	details.Files = make([]*FeatureElement, 0)
+
+	repoName, featureName := SplitFeatureName(name)
+	if repo, err := e.getFeaturesRepo(repoName); err == nil {
+		details.Description = featureDescription(repo, featureName, ref)
+	}
+
+	// Plugins attribution is given by features dependencies.
+	declaredBy := make(map[string]string)
+	for _, featureElement := range sortedElementNames(e.GetElements(featureType)) {
+		feature := e.GetElement(featureType, featureElement).(*Feature)
+		if feature.name != name {
+			details.Features = append(details.Features, feature.name)
+		}
+		for depName, dep := range feature.GetDependencies() {
+			if dep.GetType() == pluginType {
+				declaredBy[depName] = feature.name
+			}
+		}
+	}
+
+	plugins := e.GetElements(pluginType)
+	for _, pluginName := range sortedElementNames(plugins) {
+		plugin := plugins[pluginName].(*Plugin)
+		if e.ref != nil {
+			if err = plugin.DefineLatestPossibleVersion(e); err != nil {
+				return nil, err
+			}
+		}
+		details.Plugins = append(details.Plugins, &FeatureElement{
+			Type:    pluginType,
+			Name:    pluginName,
+			Version: plugin.Version,
+			Feature: declaredBy[pluginName],
+		})
+	}
+
+	groovies := e.GetElements(groovyType)
+	for _, groovyName := range sortedElementNames(groovies) {
+		groovy := groovies[groovyName].(*Groovy)
+		details.Groovies = append(details.Groovies, &FeatureElement{
+			Type:    groovyType,
+			Name:    qualifiedName(groovy.repoName, path.Join(groovy.featureName, groovy.name)),
+			Version: groovy.CommitID,
+			Feature: qualifiedName(groovy.repoName, groovy.featureName),
+		})
+	}
+
+	for _, elementType := range []string{cascType, fileType} {
+		files := e.GetElements(elementType)
+		for _, fileName := range sortedElementNames(files) {
+			file := files[fileName].(*FeatureFile)
+			details.Files = append(details.Files, &FeatureElement{
+				Type:    elementType,
+				Name:    qualifiedName(file.repoName, path.Join(file.featureName, file.name)),
+				Version: file.CommitID,
+				Dest:    file.Dest,
+				Feature: qualifiedName(file.repoName, file.featureName),
+			})
+		}
+	}
+	sort.Slice(details.Files, func(i, j int) bool {
+		return details.Files[i].Name < details.Files[j].Name
+	})
+	return
+}
+
+/************************************************************************
+ ***************** INTERNAL FUNCTIONS ***********************************
+ ************************************************************************/
+
+// featureDescription return the description header of a feature desc file, read at the reference given if set.
+func featureDescription(repo *FeaturesRepo, featureName, ref string) string {
+	featureDesc := path.Join(featureName, featureName+".desc")
+	if ref != "" {
+		commit, err := repo.ResolveRef(ref)
+		if err != nil {
+			return ""
+		}
+		data, err := repo.showFile(commit, featureDesc)
+		if err != nil {
+			return ""
+		}
+		return descHeader(data)
+	}
+	data, err := ioutil.ReadFile(path.Join(repo.Path(), featureDesc))
+	if err != nil {
+		return ""
+	}
+	return descHeader(string(data))
+}
+
+// descHeader return the comment lines found at the top of a desc file, without the '#' prefix.
+func descHeader(data string) string {
+	header := make([]string, 0, 2)
+	fileScan := bufio.NewScanner(strings.NewReader(data))
+	for fileScan.Scan() {
+		line := strings.Trim(fileScan.Text(), " \t")
+		if line == "" && len(header) == 0 {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		header = append(header, strings.Trim(strings.TrimLeft(line, "#"), " \t"))
+	}
+	return strings.Trim(strings.Join(header, "\n"), "\n")
+}
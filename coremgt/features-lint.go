@@ -0,0 +1,322 @@
+package coremgt
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	git "github.com/forj-oss/go-git"
+	goversion "github.com/hashicorp/go-version"
+)
+
+const (
+	// LintError is the severity of a diagnostic which breaks the lock file generation.
+	LintError = "error"
+	// LintWarning is the severity of a diagnostic which may be an issue.
+	LintWarning = "warning"
+)
+
+// LintDiagnostic is an issue found in a feature descriptor, located by file and line.
+type LintDiagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// String return the diagnostic as `<file>:<line>: <severity>: <message>`
+func (d LintDiagnostic) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s", d.File, d.Line, d.Severity, d.Message)
+}
+
+// FeaturesLint validates all feature descriptors of a features repository.
+//
+// Checks done:
+// - unknown element types and invalid lines
+// - groovies, casc and files missing or not committed to git
+// - plugins missing from the updates repository (skipped without repository)
+// - invalid version constraints, plugin states, duplicate entries and contradictory pins
+// - included features which do not exist
+type FeaturesLint struct {
+	repoPath    string
+	ref         *Repository
+	diagnostics []LintDiagnostic
+	pins        map[string]lintPin // plugin fixed versions, to report contradictory pins between features.
+}
+
+type lintPin struct {
+	version string
+	file    string
+	line    int
+}
+
+// lintEntry is a desc line already read, to detect duplicates and contradictory constraints.
+type lintEntry struct {
+	line    int
+	version string
+}
+
+// NewFeaturesLint creates a FeaturesLint object. ref can be nil to skip the updates repository checks.
+func NewFeaturesLint(repoPath string, ref *Repository) (ret *FeaturesLint) {
+	ret = new(FeaturesLint)
+	ret.repoPath = repoPath
+	ret.ref = ref
+	ret.diagnostics = make([]LintDiagnostic, 0)
+	ret.pins = make(map[string]lintPin)
+	return
+}
+
+// Lint check every feature descriptor found in the repository and return diagnostics sorted by file and line.
+func (l *FeaturesLint) Lint() (_ []LintDiagnostic, err error) {
+	if l == nil {
+		return
+	}
+	features, err := ListFeatures(l.repoPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, feature := range features {
+		l.lintFeature(feature.Name)
+	}
+
+	sort.SliceStable(l.diagnostics, func(i, j int) bool {
+		if l.diagnostics[i].File != l.diagnostics[j].File {
+			return l.diagnostics[i].File < l.diagnostics[j].File
+		}
+		return l.diagnostics[i].Line < l.diagnostics[j].Line
+	})
+	return l.diagnostics, nil
+}
+
+// Errors return the number of error diagnostics found.
+func (l *FeaturesLint) Errors() (count int) {
+	if l == nil {
+		return
+	}
+	for _, diagnostic := range l.diagnostics {
+		if diagnostic.Severity == LintError {
+			count++
+		}
+	}
+	return
+}
+
+/************************************************************************
+ ***************** INTERNAL FUNCTIONS ***********************************
+ ************************************************************************/
+
+func (l *FeaturesLint) report(file string, line int, severity, format string, args ...interface{}) {
+	l.diagnostics = append(l.diagnostics, LintDiagnostic{
+		File:     file,
+		Line:     line,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// lintFeature check a feature descriptor line by line.
+func (l *FeaturesLint) lintFeature(featureName string) {
+	descFile := path.Join(featureName, featureName+".desc")
+	fd, err := os.Open(path.Join(l.repoPath, descFile))
+	if err != nil {
+		l.report(descFile, 0, LintError, "Unable to read the feature descriptor. %s", err)
+		return
+	}
+	defer fd.Close()
+
+	if history, _ := gitFileHistory(l.repoPath, "", descFile); len(history) == 0 {
+		l.report(descFile, 0, LintError, "Feature descriptor is not committed to git")
+	}
+
+	entries := make(map[string]lintEntry)
+	constraints := make(map[string][]lintEntry)
+
+	lineNumber := 0
+	fileScan := bufio.NewScanner(fd)
+	for fileScan.Scan() {
+		lineNumber++
+		line := strings.Trim(fileScan.Text(), " \t")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		fields := strings.Split(line, ":")
+		for index := range fields {
+			fields[index] = strings.Trim(fields[index], " ")
+		}
+		if len(fields) < 2 || fields[1] == "" {
+			l.report(descFile, lineNumber, LintError, "Invalid line '%s'. Expect '<type>:<name>[:<version>]'", line)
+			continue
+		}
+		elementType, name := fields[0], fields[1]
+		version := ""
+		if len(fields) >= 3 {
+			version = fields[2]
+		}
+
+		key := elementType + ":" + name
+		if previous, found := entries[key]; found && previous.version == version {
+			l.report(descFile, lineNumber, LintWarning, "Duplicate entry '%s'. Already declared at line %d", key, previous.line)
+			continue
+		}
+		entries[key] = lintEntry{line: lineNumber, version: version}
+
+		switch elementType {
+		case pluginType:
+			if l.lintPlugin(descFile, lineNumber, name, version) {
+				constraints[name] = append(constraints[name], lintEntry{line: lineNumber, version: version})
+			}
+			if len(fields) >= 4 {
+				if _, err := parsePluginStates(fields[3]); err != nil {
+					l.report(descFile, lineNumber, LintError, "%s", err)
+				}
+			}
+		case groovyType:
+			l.lintFile(descFile, lineNumber, path.Join(featureName, name+".groovy"))
+		case cascType:
+			l.lintFile(descFile, lineNumber, path.Join(featureName, name))
+		case fileType:
+			l.lintFile(descFile, lineNumber, path.Join(featureName, name))
+			if version == "" {
+				l.report(descFile, lineNumber, LintError, "Missing destination. Expect '%s:<src>:<dest>'", fileType)
+			} else if err := checkFileDest(version); err != nil {
+				l.report(descFile, lineNumber, LintError, "%s", err)
+			}
+		case featureType:
+			l.lintNestedFeature(descFile, lineNumber, featureName, name, version)
+		default:
+			l.report(descFile, lineNumber, LintError, "Unknown element type '%s'. Expect one of plugin, groovy, casc, file or feature", elementType)
+		}
+	}
+
+	l.lintConstraints(descFile, constraints)
+}
+
+// lintPlugin check the plugin exists in the updates repository and its version constraint is valid.
+// It returns true if the constraint is valid.
+func (l *FeaturesLint) lintPlugin(descFile string, line int, name, version string) (_ bool) {
+	if l.ref != nil {
+		if _, found := l.ref.Get(name); !found {
+			l.report(descFile, line, LintError, "Plugin '%s' not found in the updates repository", name)
+			return
+		}
+	}
+	if version == "" {
+		return true
+	}
+	if _, err := goversion.NewConstraint(version); err != nil {
+		l.report(descFile, line, LintError, "Invalid version constraint '%s' for plugin '%s'. %s", version, name, err)
+		return
+	}
+
+	if pinned, fixed := pinnedVersion(version); fixed {
+		if l.ref != nil {
+			if _, found := l.ref.Get(name, pinned); !found {
+				l.report(descFile, line, LintError, "Plugin '%s' version %s not found in the updates repository", name, pinned)
+			}
+		}
+		if pin, found := l.pins[name]; found && pin.version != pinned && pin.file != descFile {
+			l.report(descFile, line, LintWarning, "Plugin '%s' is pinned to %s while %s:%d pins it to %s", name, pinned, pin.file, pin.line, pin.version)
+		} else if !found {
+			l.pins[name] = lintPin{version: pinned, file: descFile, line: line}
+		}
+	}
+	return true
+}
+
+// lintConstraints report contradictory constraints of a plugin in the same descriptor.
+func (l *FeaturesLint) lintConstraints(descFile string, constraints map[string][]lintEntry) {
+	for name, entries := range constraints {
+		pinnedLine := 0
+		pinned := ""
+		for _, entry := range entries {
+			version, fixed := pinnedVersion(entry.version)
+			if !fixed {
+				continue
+			}
+			if pinned != "" && version != pinned {
+				l.report(descFile, entry.line, LintError, "Plugin '%s' pinned to %s, while pinned to %s at line %d", name, version, pinned, pinnedLine)
+				continue
+			}
+			pinned = version
+			pinnedLine = entry.line
+		}
+		if pinned == "" {
+			continue
+		}
+		pinnedVersionObject, err := goversion.NewVersion(pinned)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if _, fixed := pinnedVersion(entry.version); fixed || entry.version == "" {
+				continue
+			}
+			if constraint, err := goversion.NewConstraint(entry.version); err == nil && !constraint.Check(pinnedVersionObject) {
+				l.report(descFile, entry.line, LintError, "Plugin '%s' constraint '%s' contradicts the version %s pinned at line %d", name, entry.version, pinned, pinnedLine)
+			}
+		}
+	}
+}
+
+// lintFile check a feature file exists and is committed to git.
+func (l *FeaturesLint) lintFile(descFile string, line int, file string) {
+	if info, err := os.Stat(path.Join(l.repoPath, file)); err != nil || info.IsDir() {
+		l.report(descFile, line, LintError, "'%s' not found", file)
+		return
+	}
+	if history, _ := gitFileHistory(l.repoPath, "", file); len(history) == 0 {
+		l.report(descFile, line, LintError, "'%s' is not committed to git", file)
+		return
+	}
+	git.RunInPath(l.repoPath, func() error {
+		if status, err := git.Get("status", "--porcelain", "--", file); err == nil && strings.Trim(status, " \n") != "" {
+			l.report(descFile, line, LintWarning, "'%s' has uncommitted changes", file)
+		}
+		return nil
+	})
+}
+
+// lintNestedFeature check an included feature exists. Features from named repositories are not verified.
+func (l *FeaturesLint) lintNestedFeature(descFile string, line int, featureName, name, ref string) {
+	repoName, nestedName := SplitFeatureName(name)
+	if repoName != "" {
+		return
+	}
+	if nestedName == featureName {
+		l.report(descFile, line, LintError, "Feature '%s' includes itself", featureName)
+		return
+	}
+	nestedDesc := path.Join(nestedName, nestedName+".desc")
+	if ref != "" {
+		commit, err := gitResolveRef(l.repoPath, ref)
+		if err != nil {
+			l.report(descFile, line, LintError, "%s", err)
+			return
+		}
+		if _, err := gitShowFile(l.repoPath, commit, nestedDesc); err != nil {
+			l.report(descFile, line, LintError, "Feature '%s' not found at '%s'", nestedName, ref)
+		}
+		return
+	}
+	if info, err := os.Stat(path.Join(l.repoPath, nestedDesc)); err != nil || info.IsDir() {
+		l.report(descFile, line, LintError, "Feature '%s' not found", nestedName)
+	}
+}
+
+// pinnedVersion return the version if the constraint fixes the version (no operator or '=')
+func pinnedVersion(constraint string) (version string, fixed bool) {
+	constraintPiecesRe, _ := regexp.Compile(`^([<>=!~]*)(.*)$`)
+	constraintPieces := constraintPiecesRe.FindStringSubmatch(constraint)
+	if constraintPieces == nil || constraint == "" {
+		return
+	}
+	if constraintPieces[1] == "" || constraintPieces[1] == "=" {
+		return strings.Trim(constraintPieces[2], " "), true
+	}
+	return
+}
@@ -0,0 +1,420 @@
+package coremgt
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"jplugins/simplefile"
+
+	"github.com/forj-oss/forjj-modules/trace"
+	git "github.com/forj-oss/go-git"
+	"github.com/forj-oss/utils"
+)
+
+const (
+	repoType = "repo"
+
+	// FeaturesReposCachePath is the directory where jplugins clones features repositories.
+	FeaturesReposCachePath = ".jplugins/repo-cache"
+	// featuresRepoCloneConfig is the GIT configuration set in repositories cloned by jplugins.
+	// jplugins never fetches or resets a repository without it.
+	featuresRepoCloneConfig = "jplugins.clone"
+
+	// GitUsernameEnv is the environment variable name of the user to authenticate on an HTTPS features repository.
+	GitUsernameEnv = "JPLUGINS_GIT_USERNAME"
+	// GitTokenEnv is the environment variable name of the token/password to authenticate on an HTTPS features repository.
+	GitTokenEnv = "JPLUGINS_GIT_TOKEN"
+	// GitSSHKeyEnv is the environment variable name of the SSH private key file to authenticate on an SSH features repository.
+	GitSSHKeyEnv = "JPLUGINS_GIT_SSH_KEY"
+)
+
+// FeaturesRepo manages the local clone of a features repository, like `jenkins-install-inits`.
+//
+// If the repository is local, jplugins uses it as is. Otherwise, the repository is cloned
+// or fetched from the URL, and the reference (branch, tag or commit ID) is checked out.
+type FeaturesRepo struct {
+	path     string
+	url      string
+	ref      string
+	useLocal bool
+	prepared bool
+}
+
+// NewFeaturesRepo creates a FeaturesRepo object
+func NewFeaturesRepo(repoPath string) (ret *FeaturesRepo) {
+	ret = new(FeaturesRepo)
+	if p, err := utils.Abs(repoPath); err == nil {
+		repoPath = p
+	}
+	ret.path = repoPath
+	return
+}
+
+// SetURL store the repository URL to clone from. (https://, ssh:// or scp like git@host:path)
+func (r *FeaturesRepo) SetURL(repoURL string) {
+	if r == nil {
+		return
+	}
+	r.url = repoURL
+}
+
+// SetRef defines the branch, tag or commit ID to checkout. By default, the remote default branch is used.
+func (r *FeaturesRepo) SetRef(ref string) {
+	if r == nil {
+		return
+	}
+	r.ref = ref
+}
+
+// SetLocal set the useLocal to true
+// When set to true, the repository is not cloned or fetched.
+func (r *FeaturesRepo) SetLocal() {
+	if r == nil {
+		return
+	}
+	r.useLocal = true
+}
+
+// Path return the repository local path.
+func (r *FeaturesRepo) Path() string {
+	if r == nil {
+		return ""
+	}
+	return r.path
+}
+
+// Prepare clone or update the repository if not local, then verify it is a valid GIT repository.
+// The clone/update is done only once.
+func (r *FeaturesRepo) Prepare() (err error) {
+	if r == nil || r.prepared {
+		return
+	}
+
+	if !r.useLocal {
+		if err = r.update(); err != nil {
+			return
+		}
+	}
+
+	if !r.isGitRepo() {
+		return fmt.Errorf("Issue with '%s', Not a valid GIT repository", r.path)
+	}
+	r.prepared = true
+	return
+}
+
+// ResolveRef return the commit ID of a branch, tag or commit ID found in the repository.
+func (r *FeaturesRepo) ResolveRef(ref string) (_ string, err error) {
+	if r == nil {
+		return "", fmt.Errorf("Features repository not defined")
+	}
+	return gitResolveRef(r.path, ref)
+}
+
+/************************************************************************
+ ***************** INTERNAL FUNCTIONS ***********************************
+ ************************************************************************/
+
+// showFile return the content of a file, relative to the repository path, at the revision given.
+func (r *FeaturesRepo) showFile(revision, file string) (string, error) {
+	return gitShowFile(r.path, revision, file)
+}
+
+// update clone the repository if missing or fetch it, then checkout the reference.
+func (r *FeaturesRepo) update() (err error) {
+	if r.url == "" {
+		return fmt.Errorf("Unable to clone '%s'. No features repository URL given", r.path)
+	}
+
+	restoreEnv := setGitCredentials(r.url)
+	defer restoreEnv()
+
+	if r.isGitRepo() {
+		if !r.isClonedByJplugins() {
+			return fmt.Errorf("'%s' was not cloned by jplugins and is not updated. "+
+				"Remove it to let jplugins clone %s, or use it as a local features repository", r.path, r.url)
+		}
+		gotrace.Info("Updating features repository '%s' from %s", r.path, r.url)
+		err = git.RunInPath(r.path, func() error {
+			if git.Do("fetch", "--tags", "--prune", "origin") != 0 {
+				return fmt.Errorf("Unable to fetch from %s", r.url)
+			}
+			return nil
+		})
+	} else {
+		gotrace.Info("Cloning features repository %s to '%s'", r.url, r.path)
+		if entries, _ := ioutil.ReadDir(r.path); len(entries) > 0 {
+			return fmt.Errorf("Unable to clone %s. '%s' exists and is not an empty directory", r.url, r.path)
+		}
+		if err = os.MkdirAll(path.Dir(r.path), 0755); err != nil {
+			return fmt.Errorf("Unable to create '%s'. %s", path.Dir(r.path), err)
+		}
+		err = git.RunInPath(path.Dir(r.path), func() error {
+			if git.Do("clone", r.url, path.Base(r.path)) != 0 {
+				return fmt.Errorf("Unable to clone %s", r.url)
+			}
+			return nil
+		})
+		if err == nil {
+			err = git.RunInPath(r.path, func() error {
+				if git.Do("config", featuresRepoCloneConfig, "true") != 0 {
+					return fmt.Errorf("Unable to configure '%s'", r.path)
+				}
+				return nil
+			})
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	return git.RunInPath(r.path, func() error {
+		return r.checkout()
+	})
+}
+
+// checkout the reference requested. A branch is reset to the remote branch.
+// Without reference, the current branch is reset to the remote one.
+func (r *FeaturesRepo) checkout() error {
+	ref := r.ref
+	if ref == "" {
+		if ref = git.GetCurrentBranch(); ref == "" || ref == "HEAD" {
+			return nil
+		}
+	}
+
+	if git.Do("rev-parse", "--verify", "-q", "origin/"+ref) == 0 {
+		if git.Do("checkout", "-q", "-B", ref, "origin/"+ref) != 0 {
+			return fmt.Errorf("Unable to checkout branch '%s' in '%s'", ref, r.path)
+		}
+		return nil
+	}
+
+	if git.Do("checkout", "-q", "--detach", ref) != 0 {
+		return fmt.Errorf("Unable to checkout '%s' in '%s'. Not a branch, tag or commit ID", ref, r.path)
+	}
+	return nil
+}
+
+// isGitRepo return true if the path is the top directory of a GIT repository
+func (r *FeaturesRepo) isGitRepo() (_ bool) {
+	if info, err := os.Stat(path.Join(r.path, ".git")); err != nil || !info.IsDir() {
+		return
+	}
+	return git.RunInPath(r.path, func() error {
+		if git.Do("rev-parse", "--git-dir") != 0 {
+			return fmt.Errorf("Not a valid GIT repository")
+		}
+		return nil
+	}) == nil
+}
+
+// isClonedByJplugins return true if the repository has been cloned by jplugins.
+func (r *FeaturesRepo) isClonedByJplugins() (_ bool) {
+	var value string
+	git.RunInPath(r.path, func() (err error) {
+		value, err = git.Get("config", "--get", featuresRepoCloneConfig)
+		return
+	})
+	return strings.Trim(value, " \n") == "true"
+}
+
+// setGitCredentials set GIT environment to authenticate with credentials given by environment
+// It returns a function to restore the previous environment.
+//
+// - HTTPS: JPLUGINS_GIT_USERNAME and JPLUGINS_GIT_TOKEN are given to GIT as http.extraHeader,
+// through environment. So, credentials are not stored in the repository configuration.
+// - SSH: JPLUGINS_GIT_SSH_KEY is used by GIT_SSH_COMMAND, if GIT_SSH_COMMAND is not already set.
+func setGitCredentials(repoURL string) (restore func()) {
+	saved := make(map[string]*string)
+	setEnv := func(name, value string) {
+		if _, found := saved[name]; !found {
+			if old, found := os.LookupEnv(name); found {
+				saved[name] = &old
+			} else {
+				saved[name] = nil
+			}
+		}
+		os.Setenv(name, value)
+	}
+	restore = func() {
+		for name, value := range saved {
+			if value == nil {
+				os.Unsetenv(name)
+			} else {
+				os.Setenv(name, *value)
+			}
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(repoURL, "https://") || strings.HasPrefix(repoURL, "http://"):
+		user := os.Getenv(GitUsernameEnv)
+		token := os.Getenv(GitTokenEnv)
+		if token == "" {
+			return
+		}
+		if user == "" {
+			user = "jplugins"
+		}
+		count := 0
+		if value, err := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT")); err == nil {
+			count = value
+		}
+		gotrace.Trace("Using credentials from %s/%s", GitUsernameEnv, GitTokenEnv)
+		setEnv("GIT_CONFIG_KEY_"+strconv.Itoa(count), "http.extraHeader")
+		setEnv("GIT_CONFIG_VALUE_"+strconv.Itoa(count), "Authorization: Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+token)))
+		setEnv("GIT_CONFIG_COUNT", strconv.Itoa(count+1))
+	default: // ssh://, git@host:path (scp like syntax) or local paths.
+		sshKey := os.Getenv(GitSSHKeyEnv)
+		if sshKey == "" || os.Getenv("GIT_SSH_COMMAND") != "" {
+			return
+		}
+		gotrace.Trace("Using SSH key from %s", GitSSHKeyEnv)
+		setEnv("GIT_SSH_COMMAND", "ssh -i '"+sshKey+"' -o IdentitiesOnly=yes")
+	}
+	return
+}
+
+// gitResolveRef return the commit ID of a reference (branch, tag or commit ID) in the repository given.
+// Remote branches are checked first, as local branches of a cloned repository can be outdated.
+func gitResolveRef(repoPath, ref string) (commit string, err error) {
+	err = git.RunInPath(repoPath, func() (err error) {
+		for _, candidate := range []string{"origin/" + ref, ref} {
+			if git.Do("rev-parse", "--verify", "-q", candidate+"^{commit}") != 0 {
+				continue
+			}
+			if commit, err = git.Get("rev-parse", candidate+"^{commit}"); err != nil {
+				return
+			}
+			commit = strings.Trim(commit, " \n")
+			return
+		}
+		return fmt.Errorf("'%s' is not a branch, tag or commit ID of '%s'", ref, repoPath)
+	})
+	return
+}
+
+// gitShowFile return the content of a file at the revision given.
+// The file path is relative to repoPath, which can be a sub directory of the repository.
+func gitShowFile(repoPath, revision, file string) (data string, err error) {
+	err = git.RunInPath(repoPath, func() (err error) {
+		if data, err = git.Get("show", revision+":./"+file); err != nil {
+			return fmt.Errorf("Unable to read '%s' at revision '%s'. %s", file, revision, err)
+		}
+		return
+	})
+	return
+}
+
+// gitFileHistory return the list of commit IDs which updated the file, from the revision given (HEAD if empty).
+// The file path is relative to repoPath, which can be a sub directory of the repository.
+func gitFileHistory(repoPath, revision, file string) (history []string, err error) {
+	args := []string{"log", "--pretty=%H"}
+	if revision != "" {
+		args = append(args, revision)
+	}
+	args = append(args, "--", file)
+
+	err = git.RunInPath(repoPath, func() (_ error) {
+		historyData, err := git.Get(args...)
+		if err != nil {
+			return fmt.Errorf("Unable to get file '%s' history from GIT. %s", file, err)
+		}
+		history = make([]string, 0, 5)
+		for _, commit := range strings.Split(strings.Trim(historyData, " \n"), "\n") {
+			if commit != "" {
+				history = append(history, commit)
+			}
+		}
+		return
+	})
+	return
+}
+
+// featuresRepos is the list of named features repositories, declared with `repo:<name>:<url>`.
+// Named repositories are always cloned in the jplugins cache directory, even if the default features
+// repository is a local one.
+type featuresRepos struct {
+	urls  map[string]string
+	repos map[string]*FeaturesRepo
+}
+
+func newFeaturesRepos() (ret *featuresRepos) {
+	ret = new(featuresRepos)
+	ret.urls = make(map[string]string)
+	ret.repos = make(map[string]*FeaturesRepo)
+	return
+}
+
+// add register a named features repository URL.
+func (r *featuresRepos) add(name, repoURL string) error {
+	if name == "" || strings.ContainsAny(name, "/:") {
+		return fmt.Errorf("Invalid features repository name '%s'", name)
+	}
+	if repoURL == "" {
+		return fmt.Errorf("Missing URL for features repository '%s'. Expect '%s:<name>:<url>'", name, repoType)
+	}
+	if existing, found := r.urls[name]; found && existing != repoURL {
+		return fmt.Errorf("Features repository '%s' declared twice with 2 different URLs. '%s' vs '%s'", name, existing, repoURL)
+	}
+	r.urls[name] = repoURL
+	return nil
+}
+
+// get return the named repository object.
+func (r *featuresRepos) get(name string) (repo *FeaturesRepo, _ error) {
+	if repo, found := r.repos[name]; found {
+		return repo, nil
+	}
+	repoURL, found := r.urls[name]
+	if !found {
+		return nil, fmt.Errorf("Unknown features repository '%s'. Declare it with '%s:%s:<url>'", name, repoType, name)
+	}
+	repo = NewFeaturesRepo(namedFeaturesRepoPath(name))
+	repo.SetURL(repoURL)
+	r.repos[name] = repo
+	return
+}
+
+// addToLockFile add named repositories records to the lock file data.
+func (r *featuresRepos) addToLockFile(lockFile *simplefile.SimpleFile) {
+	for name, repoURL := range r.urls {
+		lockFile.AddWithKeyString("0-"+repoType+"-"+name, repoType, name, repoURL)
+	}
+}
+
+// namedFeaturesRepoPath return where a named features repository is cloned.
+func namedFeaturesRepoPath(name string) string {
+	return path.Join(FeaturesReposCachePath, name)
+}
+
+// SplitFeatureName return the repository name and the feature name from a feature reference `[<repo>/]<feature>`
+// The default features repository has an empty name.
+func SplitFeatureName(name string) (repoName, featureName string) {
+	if pieces := strings.SplitN(name, "/", 2); len(pieces) == 2 {
+		return pieces[0], pieces[1]
+	}
+	return "", name
+}
+
+// qualifiedName prefix the name with the repository name, if not the default one.
+func qualifiedName(repoName, name string) string {
+	if repoName == "" {
+		return name
+	}
+	return repoName + "/" + name
+}
+
+// relativeName remove the repository name prefix from a qualified name.
+func relativeName(repoName, name string) string {
+	if repoName == "" {
+		return name
+	}
+	return strings.TrimPrefix(name, repoName+"/")
+}
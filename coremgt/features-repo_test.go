@@ -0,0 +1,197 @@
+package coremgt
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+)
+
+// testGitRemote is a bare repository used as features repository remote, with a working clone to push to it.
+type testGitRemote struct {
+	t       *testing.T
+	dir     string
+	url     string
+	workDir string
+}
+
+func newTestGitRemote(t *testing.T) (r *testGitRemote) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "jplugins-features-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = &testGitRemote{t: t, dir: dir, url: path.Join(dir, "remote.git"), workDir: path.Join(dir, "work")}
+	r.git(dir, "init", "-q", "--bare", r.url)
+	r.git(r.url, "symbolic-ref", "HEAD", "refs/heads/master")
+	r.git(dir, "init", "-q", r.workDir)
+	r.git(r.workDir, "symbolic-ref", "HEAD", "refs/heads/master")
+	r.git(r.workDir, "remote", "add", "origin", r.url)
+	return
+}
+
+func (r *testGitRemote) close() {
+	os.RemoveAll(r.dir)
+}
+
+func (r *testGitRemote) git(dir string, args ...string) string {
+	cmd := exec.Command("git", append([]string{"-c", "user.name=jplugins", "-c", "user.email=jplugins@example.com"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("git %s failed. %s\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.Trim(string(out), " \n")
+}
+
+// commit add a commit updating the file on the branch given, push it and return its ID.
+func (r *testGitRemote) commit(branch, file, content string) string {
+	if r.git(r.workDir, "symbolic-ref", "--short", "HEAD") != branch {
+		r.git(r.workDir, "checkout", "-q", "-B", branch)
+	}
+	if err := ioutil.WriteFile(path.Join(r.workDir, file), []byte(content), 0644); err != nil {
+		r.t.Fatal(err)
+	}
+	r.git(r.workDir, "add", file)
+	r.git(r.workDir, "commit", "-q", "-m", "Update "+file)
+	r.git(r.workDir, "push", "-q", "origin", branch)
+	return r.git(r.workDir, "rev-parse", "HEAD")
+}
+
+func (r *testGitRemote) tag(name string) {
+	r.git(r.workDir, "tag", name)
+	r.git(r.workDir, "push", "-q", "origin", name)
+}
+
+func prepareTestFeaturesRepo(t *testing.T, remote *testGitRemote, repoPath, ref string) *FeaturesRepo {
+	repo := NewFeaturesRepo(repoPath)
+	repo.SetURL(remote.url)
+	repo.SetRef(ref)
+	if err := repo.Prepare(); err != nil {
+		t.Fatalf("Prepare '%s' failed. %s", ref, err)
+	}
+	return repo
+}
+
+func TestFeaturesRepoCloneAndFetch(t *testing.T) {
+	remote := newTestGitRemote(t)
+	defer remote.close()
+	first := remote.commit("master", "feature.desc", "v1")
+
+	repoPath := path.Join(remote.dir, "repo-cache", "features")
+	prepareTestFeaturesRepo(t, remote, repoPath, "")
+	if head := remote.git(repoPath, "rev-parse", "HEAD"); head != first {
+		t.Errorf("Expected '%s' cloned, got '%s'", first, head)
+	}
+
+	second := remote.commit("master", "feature.desc", "v2")
+	prepareTestFeaturesRepo(t, remote, repoPath, "")
+	if head := remote.git(repoPath, "rev-parse", "HEAD"); head != second {
+		t.Errorf("Expected '%s' fetched, got '%s'", second, head)
+	}
+}
+
+func TestFeaturesRepoCheckout(t *testing.T) {
+	remote := newTestGitRemote(t)
+	defer remote.close()
+	tagged := remote.commit("master", "feature.desc", "v1")
+	remote.tag("v1.0")
+	master := remote.commit("master", "feature.desc", "v2")
+	branch := remote.commit("devel", "feature.desc", "devel")
+
+	repoPath := path.Join(remote.dir, "repo-cache", "features")
+	for _, test := range []struct{ ref, expected string }{
+		{"devel", branch},
+		{"v1.0", tagged},
+		{master, master},
+		{"master", master},
+	} {
+		repo := prepareTestFeaturesRepo(t, remote, repoPath, test.ref)
+		if head := remote.git(repoPath, "rev-parse", "HEAD"); head != test.expected {
+			t.Errorf("Checkout of '%s': expected '%s', got '%s'", test.ref, test.expected, head)
+		}
+		if commit, err := repo.ResolveRef(test.ref); err != nil || commit != test.expected {
+			t.Errorf("ResolveRef of '%s': expected '%s', got '%s' (%v)", test.ref, test.expected, commit, err)
+		}
+	}
+
+	// A branch is reset to the remote one.
+	updated := remote.commit("devel", "feature.desc", "devel v2")
+	prepareTestFeaturesRepo(t, remote, repoPath, "devel")
+	if head := remote.git(repoPath, "rev-parse", "HEAD"); head != updated {
+		t.Errorf("Expected branch 'devel' updated to '%s', got '%s'", updated, head)
+	}
+}
+
+func TestFeaturesRepoLocalUntouched(t *testing.T) {
+	remote := newTestGitRemote(t)
+	defer remote.close()
+	remote.commit("master", "feature.desc", "v1")
+
+	localPath := path.Join(remote.dir, "local")
+	remote.git(remote.dir, "clone", "-q", remote.url, localPath)
+	local := remote.git(localPath, "rev-parse", "HEAD")
+	remote.commit("master", "feature.desc", "v2")
+
+	repo := NewFeaturesRepo(localPath)
+	repo.SetURL(remote.url)
+	repo.SetRef("master")
+	repo.SetLocal()
+	if err := repo.Prepare(); err != nil {
+		t.Fatalf("Prepare of a local repository failed. %s", err)
+	}
+	if head := remote.git(localPath, "rev-parse", "HEAD"); head != local {
+		t.Errorf("Local repository HEAD changed from '%s' to '%s'", local, head)
+	}
+	if origin := remote.git(localPath, "rev-parse", "origin/master"); origin != local {
+		t.Errorf("Local repository fetched. origin/master is '%s'", origin)
+	}
+
+	// Not local, but not cloned by jplugins.
+	repo = NewFeaturesRepo(localPath)
+	repo.SetURL(remote.url)
+	if err := repo.Prepare(); err == nil {
+		t.Errorf("Prepare must refuse to update a repository not cloned by jplugins")
+	}
+	if origin := remote.git(localPath, "rev-parse", "origin/master"); origin != local {
+		t.Errorf("Repository not cloned by jplugins fetched. origin/master is '%s'", origin)
+	}
+}
+
+func TestSetGitCredentials(t *testing.T) {
+	for _, name := range []string{GitUsernameEnv, GitTokenEnv, GitSSHKeyEnv, "GIT_SSH_COMMAND", "GIT_CONFIG_COUNT"} {
+		if value, found := os.LookupEnv(name); found {
+			defer os.Setenv(name, value)
+		} else {
+			defer os.Unsetenv(name)
+		}
+		os.Unsetenv(name)
+	}
+
+	os.Setenv(GitUsernameEnv, "user")
+	os.Setenv(GitTokenEnv, "token")
+	restore := setGitCredentials("https://example.com/features.git")
+	if os.Getenv("GIT_CONFIG_COUNT") != "1" || os.Getenv("GIT_CONFIG_KEY_0") != "http.extraHeader" ||
+		os.Getenv("GIT_CONFIG_VALUE_0") != "Authorization: Basic dXNlcjp0b2tlbg==" {
+		t.Errorf("Unexpected HTTPS credentials environment: %s=%s, %s", os.Getenv("GIT_CONFIG_KEY_0"),
+			os.Getenv("GIT_CONFIG_VALUE_0"), os.Getenv("GIT_CONFIG_COUNT"))
+	}
+	restore()
+	if _, found := os.LookupEnv("GIT_CONFIG_COUNT"); found {
+		t.Errorf("GIT_CONFIG_COUNT not restored")
+	}
+
+	os.Setenv(GitSSHKeyEnv, "/keys/id_rsa")
+	restore = setGitCredentials("git@example.com:features.git")
+	if expected := "ssh -i '/keys/id_rsa' -o IdentitiesOnly=yes"; os.Getenv("GIT_SSH_COMMAND") != expected {
+		t.Errorf("Expected GIT_SSH_COMMAND '%s', got '%s'", expected, os.Getenv("GIT_SSH_COMMAND"))
+	}
+	restore()
+	if _, found := os.LookupEnv("GIT_SSH_COMMAND"); found {
+		t.Errorf("GIT_SSH_COMMAND not restored")
+	}
+}
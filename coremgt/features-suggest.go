@@ -0,0 +1,152 @@
+package coremgt
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// FeatureCoverage is the coverage of a feature plugins set by installed plugins.
+type FeatureCoverage struct {
+	Name      string
+	Plugins   []string // Plugins declared by the feature and included features.
+	Installed []string
+	Missing   []string
+	Score     int // Percentage of the feature plugins installed.
+}
+
+// FeaturesSuggestion is the result of features detection on a list of installed plugins.
+type FeaturesSuggestion struct {
+	Features    []*FeatureCoverage // Features selected, sorted by name.
+	Explained   []string           // Installed plugins brought by selected features, directly or as dependencies.
+	Unexplained []string           // Top installed plugins not brought by any selected feature.
+	Total       int                // Number of installed plugins.
+}
+
+// Score return the percentage of installed plugins explained by selected features.
+func (s *FeaturesSuggestion) Score() int {
+	if s == nil || s.Total == 0 {
+		return 0
+	}
+	return len(s.Explained) * 100 / s.Total
+}
+
+// SuggestFeatures detects features of the repository whose plugins are installed, at minCoverage percent at least.
+// Plugins brought by selected features (and their dependencies) are explained. Top plugins not explained remain.
+func SuggestFeatures(repoPath string, installed *ElementsType, minCoverage int) (suggestion *FeaturesSuggestion, err error) {
+	features, err := ListFeatures(repoPath)
+	if err != nil {
+		return
+	}
+
+	installedPlugins := installed.GetElements(pluginType)
+	suggestion = new(FeaturesSuggestion)
+	suggestion.Features = make([]*FeatureCoverage, 0)
+	suggestion.Total = len(installedPlugins)
+
+	explained := make(map[string]bool)
+	for _, feature := range features {
+		plugins := featurePlugins(repoPath, feature.Name, make(map[string]bool))
+		if len(plugins) == 0 {
+			continue
+		}
+		coverage := &FeatureCoverage{Name: feature.Name, Plugins: plugins}
+		for _, name := range plugins {
+			if _, found := installedPlugins[name]; found {
+				coverage.Installed = append(coverage.Installed, name)
+			} else {
+				coverage.Missing = append(coverage.Missing, name)
+			}
+		}
+		coverage.Score = len(coverage.Installed) * 100 / len(plugins)
+		if coverage.Score < minCoverage {
+			continue
+		}
+		suggestion.Features = append(suggestion.Features, coverage)
+		for _, name := range coverage.Installed {
+			addPluginDependencies(installedPlugins, name, explained)
+		}
+	}
+
+	top := installed.ExtractTopElements().GetElements(pluginType)
+	for _, name := range sortedElementNames(installedPlugins) {
+		if explained[name] {
+			suggestion.Explained = append(suggestion.Explained, name)
+		} else if _, found := top[name]; found {
+			suggestion.Unexplained = append(suggestion.Unexplained, name)
+		}
+	}
+	return
+}
+
+/************************************************************************
+ ***************** INTERNAL FUNCTIONS ***********************************
+ ************************************************************************/
+
+// featurePlugins return the sorted list of plugins declared by a feature and its included features.
+// Features from named repositories are ignored.
+func featurePlugins(repoPath, featureName string, loaded map[string]bool) (plugins []string) {
+	if loaded[featureName] {
+		return
+	}
+	loaded[featureName] = true
+
+	fd, err := os.Open(path.Join(repoPath, featureName, featureName+".desc"))
+	if err != nil {
+		return
+	}
+	defer fd.Close()
+
+	found := make(map[string]bool)
+	fileScan := bufio.NewScanner(fd)
+	for fileScan.Scan() {
+		line := strings.Trim(fileScan.Text(), " \t")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < 2 {
+			continue
+		}
+		switch strings.Trim(fields[0], " ") {
+		case pluginType:
+			found[strings.Trim(fields[1], " ")] = true
+		case featureType:
+			if repoName, nestedName := SplitFeatureName(strings.Trim(fields[1], " ")); repoName == "" {
+				for _, name := range featurePlugins(repoPath, nestedName, loaded) {
+					found[name] = true
+				}
+			}
+		}
+	}
+
+	plugins = make([]string, 0, len(found))
+	for name := range found {
+		plugins = append(plugins, name)
+	}
+	sort.Strings(plugins)
+	return
+}
+
+// addPluginDependencies mark the installed plugin and its installed dependencies recursively.
+func addPluginDependencies(installedPlugins Elements, name string, marked map[string]bool) {
+	if marked[name] {
+		return
+	}
+	element, found := installedPlugins[name]
+	if !found {
+		return
+	}
+	marked[name] = true
+
+	plugin, ok := element.(*Plugin)
+	if !ok || plugin.Dependencies == "" {
+		return
+	}
+	for _, depPluginDetail := range strings.Split(plugin.Dependencies, ",") {
+		depPlugin := strings.Split(depPluginDetail, ":")
+		addPluginDependencies(installedPlugins, depPlugin[0], marked)
+	}
+}
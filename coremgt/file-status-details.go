@@ -0,0 +1,104 @@
+package coremgt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/forj-oss/forjj-modules/trace"
+)
+
+// FileStatusDetails contains a feature file (casc or file) update status
+type FileStatusDetails struct {
+	name          string // [<repo>/]<feature>/<src>
+	fileType      string
+	dest          string // Relative to the Jenkins home
+	newMd5        string
+	oldMd5        string
+	newCommit     string
+	oldCommit     string
+	commitHistory []string
+	sourcePath    string
+	repoName      string // Features repository name. Empty for the default one.
+	ref           string // Commit ID the feature is pinned to. Empty to use the repository HEAD.
+}
+
+func newFileStatusDetails(fileType, name, dest, sourcePath string) (ret *FileStatusDetails) {
+	ret = new(FileStatusDetails)
+	ret.fileType = fileType
+	ret.name = name
+	ret.dest = dest
+	ret.sourcePath = sourcePath
+	return
+}
+
+// fileName return the file name, relative to the features repository path
+func (fsd *FileStatusDetails) fileName() string {
+	return relativeName(fsd.repoName, fsd.name)
+}
+
+func (fsd *FileStatusDetails) computeM5Sum(bNew bool) (_ bool) {
+	revision := fsd.newCommit
+	if !bNew {
+		revision = fsd.oldCommit
+	}
+	md5Data, err := fileMd5(fsd.sourcePath, revision, fsd.fileName())
+	if err != nil {
+		gotrace.Error("%s", err)
+		return
+	}
+
+	if bNew {
+		fsd.newMd5 = md5Data
+	} else {
+		fsd.oldMd5 = md5Data
+	}
+	return true
+}
+
+func (fsd *FileStatusDetails) defineVersion(bNew bool) (_ bool) {
+	if fsd.commitHistory == nil {
+		history, err := gitFileHistory(fsd.sourcePath, fsd.ref, fsd.fileName())
+		if err != nil {
+			gotrace.Error("Unable to define the %s file '%s' version (commit ID)> %s", fsd.fileType, fsd.name, err)
+			return
+		}
+		fsd.commitHistory = history
+	}
+	if len(fsd.commitHistory) == 0 {
+		gotrace.Error("%s file '%s' not found in the features repository", fsd.fileType, fsd.name)
+		return
+	}
+	latest := fsd.commitHistory[0]
+	if bNew {
+		fsd.newCommit = latest
+	} else {
+		fsd.oldCommit = latest
+	}
+	return true
+}
+
+// lockFields return the lock file record of the file
+func (fsd *FileStatusDetails) lockFields() []string {
+	return []string{fsd.fileType, fsd.name, fsd.newCommit, fsd.repoName, fsd.dest}
+}
+
+// installIt write the file, read at the commit ID, to its destination in the Jenkins home.
+func (fsd *FileStatusDetails) installIt(homePath string) error {
+	data, err := gitShowFile(fsd.sourcePath, fsd.newCommit, fsd.fileName())
+	if err != nil {
+		return err
+	}
+
+	destFile := path.Join(homePath, fsd.dest)
+	if err = os.MkdirAll(path.Dir(destFile), 0755); err != nil {
+		return fmt.Errorf("Unable to create '%s'. %s", path.Dir(destFile), err)
+	}
+	if err = ioutil.WriteFile(destFile, []byte(data), 0644); err != nil {
+		return fmt.Errorf("Unable to write '%s'. %s", destFile, err)
+	}
+
+	gotrace.Trace("Copied: %s (%s) => %s", fsd.fileName(), fsd.newCommit, destFile)
+	return nil
+}
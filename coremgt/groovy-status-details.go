@@ -24,6 +24,8 @@ type GroovyStatusDetails struct {
 	oldCommit     string
 	commitHistory []string
 	sourcePath    string
+	repoName      string // Features repository name. Empty for the default one.
+	ref           string // Commit ID the feature is pinned to. Empty to use the repository HEAD.
 }
 
 func newGroovyStatusDetails(name, sourcePath string) (ret *GroovyStatusDetails) {
@@ -33,16 +35,31 @@ func newGroovyStatusDetails(name, sourcePath string) (ret *GroovyStatusDetails)
 	return
 }
 
+// fileName return the groovy file name, relative to the features repository path
+func (gsd *GroovyStatusDetails) fileName() string {
+	return relativeName(gsd.repoName, gsd.name) + ".groovy"
+}
+
 func (gsd *GroovyStatusDetails) computeM5Sum(bNew bool) (_ bool) {
-	groovyFile := path.Join(gsd.sourcePath, gsd.name+".groovy")
-	fd, err := os.Open(groovyFile)
-	if err != nil {
-		gotrace.Error("Unable to read '%s'. %s", groovyFile, err)
-		return
-	}
-	defer fd.Close()
+	var reader io.Reader
+	if gsd.ref != "" {
+		data, err := gitShowFile(gsd.sourcePath, gsd.ref, gsd.fileName())
+		if err != nil {
+			gotrace.Error("%s", err)
+			return
+		}
+		reader = strings.NewReader(data)
+	} else {
+		groovyFile := path.Join(gsd.sourcePath, gsd.fileName())
+		fd, err := os.Open(groovyFile)
+		if err != nil {
+			gotrace.Error("Unable to read '%s'. %s", groovyFile, err)
+			return
+		}
+		defer fd.Close()
 
-	reader := bufio.NewReader(fd)
+		reader = bufio.NewReader(fd)
+	}
 
 	hash := md5.New()
 
@@ -63,20 +80,18 @@ func (gsd *GroovyStatusDetails) computeM5Sum(bNew bool) (_ bool) {
 
 func (gsd *GroovyStatusDetails) defineVersion(bNew bool) (_ bool) {
 	if gsd.commitHistory == nil {
-		err := git.RunInPath(gsd.sourcePath, func() (_ error) {
-			historyData, err := git.Get("log", "--pretty=%H", gsd.name+".groovy")
-			if err != nil {
-				return fmt.Errorf("Unable to get file '%s' history from GIT. %s", gsd.name+".groovy", err)
-			}
-			gsd.commitHistory = strings.Split(strings.Trim(historyData, " \n"), "\n")
-			return
-		})
+		history, err := gitFileHistory(gsd.sourcePath, gsd.ref, gsd.fileName())
 		if err != nil {
 			gotrace.Error("Unable to define the groovy '%s' version (commit ID)> %s", gsd.name, err)
 			return
 		}
+		gsd.commitHistory = history
 	}
 	if len(gsd.commitHistory) == 0 {
+		if gsd.ref != "" {
+			gotrace.Error("Groovy '%s' not found at feature revision '%s'", gsd.name, gsd.ref)
+			return
+		}
 		return true
 	}
 	latest := gsd.commitHistory[0]
@@ -91,11 +106,11 @@ func (gsd *GroovyStatusDetails) defineVersion(bNew bool) (_ bool) {
 func (gsd *GroovyStatusDetails) installIt(destPath string) error {
 	git.RunInPath(gsd.sourcePath, func() error {
 		if git.Do("checkout", gsd.newCommit) != 0 {
-			return fmt.Errorf("Unable to checkout version %s (commit ID) for %s", gsd.newCommit, gsd.name+".groovy")
+			return fmt.Errorf("Unable to checkout version %s (commit ID) for %s", gsd.newCommit, gsd.fileName())
 		}
 		return nil
 	})
-	srcFile := path.Join(gsd.sourcePath, gsd.name+".groovy")
+	srcFile := path.Join(gsd.sourcePath, gsd.fileName())
 	destFile := path.Join(destPath, path.Base(gsd.name)+".groovy")
 	srcfd, err := os.Open(srcFile)
 	if err != nil {
@@ -10,8 +10,6 @@ import (
 	"path"
 	"strings"
 
-	git "github.com/forj-oss/go-git"
-
 	"github.com/forj-oss/forjj-modules/trace"
 	goversion "github.com/hashicorp/go-version"
 )
@@ -33,6 +31,8 @@ type Groovy struct {
 	commitHistory []string
 
 	featureName string
+	repoName    string // Features repository name. Empty for the default one.
+	featureRef  string // Commit ID the feature is pinned to. Empty to use the repository HEAD.
 }
 
 // NewGroovy return a Groovy object
@@ -76,6 +76,9 @@ func (p *Groovy) SetFrom(fields ...string) (err error) {
 	if fieldsSize >= 3 {
 		p.CommitID = fields[2]
 	}
+	if fieldsSize >= 4 {
+		p.repoName = fields[3]
+	}
 	return
 }
 
@@ -89,6 +92,8 @@ func (p *Groovy) CompleteFromContext(context *ElementsType) (err error) {
 			gotrace.Error("Invalid groovy code reference. It must be defined by feature. supportContext['featureName'] not defined.")
 			return
 		}
+		p.repoName = v["repoName"]
+		p.featureRef = v["featureRef"]
 	} else {
 		gotrace.Error("Invalid groovy code reference. It must be defined by feature. supportContext is nil or not defined for 'groovy', thus missing 'featureName'.")
 		return
@@ -103,6 +108,11 @@ func (p *Groovy) CompleteFromContext(context *ElementsType) (err error) {
 	return
 }
 
+// RepoName return the features repository name of the groovy. Empty for the default features repository.
+func (p *Groovy) RepoName() string {
+	return p.repoName
+}
+
 // GetType return the internal type string
 func (p *Groovy) GetType() string {
 	return groovyType
@@ -170,6 +180,7 @@ func (p *Groovy) DefineLatestPossibleVersion(context *ElementsType) (_ error) {
 func (p *Groovy) AsNewGrooviesStatusDetails(context *ElementsType) (sd *GroovyStatusDetails) {
 	sd = newGroovyStatusDetails(p.name, context.repoPath)
 	sd.name = p.name
+	sd.repoName = p.repoName
 	sd.newMd5 = p.Md5
 	sd.newCommit = p.CommitID
 	return
@@ -181,15 +192,25 @@ func (p *Groovy) AsNewPluginsStatusDetails(context *ElementsType) (sd *pluginsSt
 }
 
 // computeM5Sum get the groovy file md5sum
+// If the feature is pinned, the file is read at the groovy commit ID.
 func (p *Groovy) computeM5Sum(sourcePath string) (_ error) {
-	groovyFile := path.Join(sourcePath, p.name+".groovy")
-	fd, err := os.Open(groovyFile)
-	if err != nil {
-		return fmt.Errorf("Unable to read '%s'. %s", groovyFile, err)
-	}
-	defer fd.Close()
+	var reader io.Reader
+	if p.featureRef != "" {
+		data, err := gitShowFile(sourcePath, p.CommitID, p.name+".groovy")
+		if err != nil {
+			return err
+		}
+		reader = strings.NewReader(data)
+	} else {
+		groovyFile := path.Join(sourcePath, p.name+".groovy")
+		fd, err := os.Open(groovyFile)
+		if err != nil {
+			return fmt.Errorf("Unable to read '%s'. %s", groovyFile, err)
+		}
+		defer fd.Close()
 
-	reader := bufio.NewReader(fd)
+		reader = bufio.NewReader(fd)
+	}
 
 	hash := md5.New()
 
@@ -204,22 +225,18 @@ func (p *Groovy) computeM5Sum(sourcePath string) (_ error) {
 }
 
 // defineVersion get the latest commit ID updating the groovy file
+// If the feature is pinned, the history starts from the feature reference.
 func (p *Groovy) defineVersion(sourcePath string) (err error) {
 	if p.commitHistory == nil {
-		err = git.RunInPath(sourcePath, func() (_ error) {
-			historyData, err := git.Get("log", "--pretty=%H", p.name+".groovy")
-			if err != nil {
-				return fmt.Errorf("Unable to get file '%s' history from GIT. %s", p.name+".groovy", err)
-			}
-			p.commitHistory = strings.Split(strings.Trim(historyData, " \n"), "\n")
-			return
-		})
-		if err != nil {
+		if p.commitHistory, err = gitFileHistory(sourcePath, p.featureRef, p.name+".groovy"); err != nil {
 			err = fmt.Errorf("Unable to define the groovy '%s' version (commit ID)> %s", p.name, err)
 			return
 		}
 	}
 	if len(p.commitHistory) == 0 {
+		if p.featureRef != "" {
+			err = fmt.Errorf("Groovy '%s' not found at feature revision '%s'", p.name, p.featureRef)
+		}
 		return
 	}
 	latest := p.commitHistory[0]
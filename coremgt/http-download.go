@@ -0,0 +1,232 @@
+package coremgt
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/forj-oss/forjj-modules/trace"
+)
+
+// DownloadConfig defines how plugins packages are requested to the updates server.
+type DownloadConfig struct {
+	Retries    int           // Number of retries after a failed request.
+	Backoff    time.Duration // Delay before the first retry. It is doubled at each retry, with jitter.
+	MaxBackoff time.Duration // Maximum delay between 2 retries.
+	Timeout    time.Duration // Timeout of each request, including the body download.
+}
+
+// DefaultDownloadConfig return the default download configuration.
+func DefaultDownloadConfig() DownloadConfig {
+	return DownloadConfig{
+		Retries:    3,
+		Backoff:    2 * time.Second,
+		MaxBackoff: time.Minute,
+		Timeout:    5 * time.Minute,
+	}
+}
+
+var downloadConfig = DefaultDownloadConfig()
+
+// retryRand is the jitter source of retries delays, seeded per process so parallel agents do not retry in lockstep.
+// It is shared by download workers.
+var (
+	retryRand      = rand.New(rand.NewSource(time.Now().UnixNano()))
+	retryRandMutex sync.Mutex
+)
+
+// SetDownloadConfig set the configuration used by plugins packages requests.
+func SetDownloadConfig(config DownloadConfig) {
+	downloadConfig = config
+}
+
+/************************************************************************
+ ***************** INTERNAL FUNCTIONS ***********************************
+ ************************************************************************/
+
+// httpRequest send a request and return the response. Transport errors, HTTP 5xx and 429 are retried.
+// The caller must close the response body.
+func httpRequest(method, url string) (resp *http.Response, err error) {
+	return httpAuthRequest(method, url, "", "")
+}
+
+// httpAuthRequest send a request as httpRequest, with basic authentication if user is not empty.
+func httpAuthRequest(method, url, user, token string) (resp *http.Response, err error) {
+	client := &http.Client{Timeout: downloadConfig.Timeout}
+	for attempt := 0; ; attempt++ {
+		var req *http.Request
+		if req, err = http.NewRequest(method, url, nil); err != nil {
+			return
+		}
+		if user != "" {
+			req.SetBasicAuth(user, token)
+		}
+		resp, err = client.Do(req)
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			return
+		}
+
+		if err == nil {
+			err = fmt.Errorf("%s", resp.Status)
+		}
+		delay := retryDelay(attempt, resp)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if attempt >= downloadConfig.Retries {
+			return nil, fmt.Errorf("Unable to read '%s'. %s", url, err)
+		}
+		gotrace.Warning("%s %s failed: %s. Retry %d/%d in %s.", method, url, err, attempt+1, downloadConfig.Retries, delay)
+		time.Sleep(delay)
+	}
+}
+
+// httpDownload download the URL to destFile and return its base64 sha256.
+// Failed or truncated downloads are retried. The download is resumed with a Range request if the server supports it.
+func httpDownload(url, destFile string) (downloadedSHA256 string, err error) {
+	destfd, err := os.Create(destFile)
+	if err != nil {
+		return
+	}
+	defer destfd.Close()
+
+	client := &http.Client{Timeout: downloadConfig.Timeout}
+	sha256File := sha256.New()
+	var written int64
+
+	for attempt := 0; ; attempt++ {
+		var resp *http.Response
+		var done bool
+		resp, done, err = httpDownloadPart(client, url, destfd, sha256File, &written)
+		if done {
+			return base64.StdEncoding.EncodeToString(sha256File.Sum(nil)), nil
+		}
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return "", fmt.Errorf("File %s not found", url)
+		}
+		if resp != nil && !retryableDownloadStatus(resp.StatusCode) {
+			return "", fmt.Errorf("Unable to read '%s'. %s", url, err)
+		}
+		if attempt >= downloadConfig.Retries {
+			return "", fmt.Errorf("Unable to read '%s'. %s", url, err)
+		}
+		delay := retryDelay(attempt, resp)
+		gotrace.Warning("Download of %s failed: %s. Retry %d/%d in %s (%d bytes received).", url, err, attempt+1, downloadConfig.Retries, delay, written)
+		time.Sleep(delay)
+	}
+}
+
+// httpDownloadPart request the URL from the written offset and append the body to destfd.
+// If the server ignores the Range request, the download restarts from the beginning.
+// done is true if the body has been received completely.
+func httpDownloadPart(client *http.Client, url string, destfd *os.File, sha256File hash.Hash, written *int64) (resp *http.Response, done bool, err error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return
+	}
+	if *written > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(*written, 10)+"-")
+	}
+	if resp, err = client.Do(req); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && *written > 0:
+		gotrace.Trace("Resuming %s from byte %d.", url, *written)
+	case resp.StatusCode == http.StatusOK:
+		if *written > 0 {
+			gotrace.Trace("%s does not support resume. Restarting download.", url)
+		}
+		if err = restartDownload(destfd, sha256File, written); err != nil {
+			return
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is invalid. Restart on next attempt.
+		err = restartDownload(destfd, sha256File, written)
+		if err == nil {
+			err = fmt.Errorf("%s", resp.Status)
+		}
+		return
+	default:
+		err = fmt.Errorf("%s", resp.Status)
+		return
+	}
+
+	expected := resp.ContentLength
+	copied, err := io.Copy(io.MultiWriter(destfd, sha256File), resp.Body)
+	*written += copied
+	if err != nil {
+		return
+	}
+	if expected >= 0 && copied != expected {
+		err = fmt.Errorf("Truncated body: %d bytes received, %d expected", copied, expected)
+		return
+	}
+	done = true
+	return
+}
+
+// restartDownload truncate the file and reset the sha256 to download the file from the beginning.
+func restartDownload(destfd *os.File, sha256File hash.Hash, written *int64) (err error) {
+	if err = destfd.Truncate(0); err != nil {
+		return
+	}
+	if _, err = destfd.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	sha256File.Reset()
+	*written = 0
+	return
+}
+
+// retryableStatus return true if the HTTP status can be fixed by retrying the request.
+func retryableStatus(status int) bool {
+	return status >= 500 || status == http.StatusTooManyRequests
+}
+
+// retryableDownloadStatus return true if a download answered with this HTTP status can be retried.
+// Bodies interrupted on 200 and 206 are retried, as well as an invalid range (416), restarted from the beginning.
+func retryableDownloadStatus(status int) bool {
+	switch status {
+	case http.StatusOK, http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable:
+		return true
+	}
+	return retryableStatus(status)
+}
+
+// retryDelay return the delay before the next attempt: exponential backoff with jitter, or the server Retry-After.
+func retryDelay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			if delay := time.Duration(seconds) * time.Second; delay <= downloadConfig.MaxBackoff {
+				return delay
+			}
+			return downloadConfig.MaxBackoff
+		}
+	}
+
+	delay := downloadConfig.Backoff
+	for index := 0; index < attempt && delay < downloadConfig.MaxBackoff; index++ {
+		delay *= 2
+	}
+	if delay > downloadConfig.MaxBackoff {
+		delay = downloadConfig.MaxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	// Jitter: between half and the full delay.
+	retryRandMutex.Lock()
+	defer retryRandMutex.Unlock()
+	return delay/2 + time.Duration(retryRand.Int63n(int64(delay/2)+1))
+}
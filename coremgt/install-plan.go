@@ -0,0 +1,375 @@
+package coremgt
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Install plan actions.
+const (
+	PlanDownload = "download" // Plugin not installed.
+	PlanReplace  = "replace"  // Plugin installed with another version or content.
+	PlanKeep     = "keep"     // Element already installed and up to date.
+	PlanRemove   = "remove"   // Element installed, but obsolete or not in the lock file anymore.
+	PlanAdd      = "add"      // Groovy or file not installed.
+	PlanUpdate   = "update"   // Groovy or file installed with another content.
+	PlanDisable  = "disable"
+	PlanEnable   = "enable"
+	PlanPin      = "pin"
+	PlanUnpin    = "unpin"
+)
+
+// InstallAction is an action `jplugins install` would do on an element of the Jenkins home.
+type InstallAction struct {
+	Action           string `json:"action"`
+	Type             string `json:"type"`
+	Name             string `json:"name"`
+	Version          string `json:"version,omitempty"`           // Plugin version or commit ID to install.
+	InstalledVersion string `json:"installed_version,omitempty"` // Plugin version installed.
+	File             string `json:"file"`                        // Relative to the Jenkins home.
+	Size             int64  `json:"size,omitempty"`              // Bytes to download. -1 if unknown.
+	Reason           string `json:"reason,omitempty"`
+}
+
+// InstallPlan is the list of actions `jplugins install` would do on a Jenkins home.
+type InstallPlan struct {
+	JenkinsHome   string           `json:"jenkins_home"`
+	Actions       []*InstallAction `json:"actions"`
+	DownloadBytes int64            `json:"download_bytes"`
+	UnknownSizes  int              `json:"unknown_sizes"` // Number of downloads with an unknown size.
+}
+
+// Plan compute the actions Install would do, without changing the Jenkins home.
+func (j *JenkinsHome) Plan(elements *ElementsType, featureRepoPath string) (plan *InstallPlan, err error) {
+	return j.plan(elements, featureRepoPath, true)
+}
+
+// plan compute the install plan. Plugins download sizes are requested to the updates server if withSizes is true.
+func (j *JenkinsHome) plan(elements *ElementsType, featureRepoPath string, withSizes bool) (plan *InstallPlan, err error) {
+	if err = elements.SetFeaturesPath(featureRepoPath); err != nil {
+		return
+	}
+	if err = j.checkInstallPaths(); err != nil {
+		return
+	}
+	installed, err := j.GetPlugins()
+	if err != nil {
+		return
+	}
+	installedPlugins := installed.GetElements(pluginType)
+
+	plan = new(InstallPlan)
+	plan.JenkinsHome = j.homePath
+	plan.Actions = make([]*InstallAction, 0)
+
+	// Files are only registered in the transaction, to identify files to remove. Nothing is written.
+	transaction := newPlanTransaction(j.homePath)
+	obsoletes := make(map[string]bool)
+
+	for _, elementType := range []string{pluginType, groovyType, cascType, fileType} {
+		elementsList := elements.GetElements(elementType)
+		for _, name := range sortedElementNames(elementsList) {
+			switch element := elementsList[name].(type) {
+			case *Plugin:
+				if element.Version == "" {
+					obsoletes[pluginType+":"+name] = true
+					continue
+				}
+				j.planPlugin(plan, element, installedPlugins[name], transaction, withSizes)
+			case *Groovy:
+				if element.CommitID == "" {
+					obsoletes[groovyType+":"+path.Base(name)] = true
+					continue
+				}
+				sourcePath, err := j.planSourcePath(elements, element.repoName, featureRepoPath)
+				if err != nil {
+					return nil, err
+				}
+				groovyObj := newGroovyStatusDetails(name, sourcePath)
+				groovyObj.repoName = element.repoName
+				file := path.Join(jenkinsHomeGroovyPath, path.Base(name)+".groovy")
+				if err = j.planFile(plan, groovyType, name, element.CommitID, file, sourcePath, groovyObj.fileName(), transaction); err != nil {
+					return nil, err
+				}
+			case *FeatureFile:
+				if element.CommitID == "" {
+					continue
+				}
+				sourcePath, err := j.planSourcePath(elements, element.repoName, featureRepoPath)
+				if err != nil {
+					return nil, err
+				}
+				fileObj := newFileStatusDetails(element.fileType, name, element.Dest, sourcePath)
+				fileObj.repoName = element.repoName
+				if err = j.planFile(plan, element.fileType, name, element.CommitID, element.Dest, sourcePath, fileObj.fileName(), transaction); err != nil {
+					return nil, err
+				}
+				if element.fileType == fileType {
+					transaction.stage(jenkinsHomeFilesList)
+				}
+			}
+		}
+	}
+
+	if err = j.cleanUp(transaction); err != nil {
+		return nil, err
+	}
+	j.planRemovals(plan, installedPlugins, obsoletes, transaction)
+	return
+}
+
+// Count return the number of actions of the kind given.
+func (p *InstallPlan) Count(action string) (count int) {
+	if p == nil {
+		return
+	}
+	for _, planAction := range p.Actions {
+		if planAction.Action == action {
+			count++
+		}
+	}
+	return
+}
+
+// PrintText display the install plan.
+func (p *InstallPlan) PrintText(out io.Writer) {
+	if p == nil {
+		return
+	}
+	fmt.Fprintf(out, "Install plan for %s\n", p.JenkinsHome)
+
+	iMaxName := 0
+	for _, action := range p.Actions {
+		if size := len(action.Type) + len(action.Name) + 1; size > iMaxName {
+			iMaxName = size
+		}
+	}
+	nameFormat := "%-8s %-" + strconv.Itoa(iMaxName) + "s : "
+	for _, action := range p.Actions {
+		fmt.Fprintf(out, nameFormat, action.Action, action.Type+":"+action.Name)
+		details := make([]string, 0, 3)
+		switch {
+		case action.InstalledVersion != "" && action.Version != "" && action.InstalledVersion != action.Version:
+			details = append(details, action.InstalledVersion+" => "+action.Version)
+		case action.Version != "":
+			details = append(details, action.Version)
+		case action.InstalledVersion != "":
+			details = append(details, action.InstalledVersion)
+		}
+		if action.Size > 0 {
+			details = append(details, "("+bytesString(action.Size)+")")
+		}
+		if action.Reason != "" {
+			details = append(details, "- "+action.Reason)
+		}
+		fmt.Fprintln(out, strings.Join(details, " "))
+	}
+	fmt.Fprintf(out, "\n%s\n", p.summary())
+}
+
+// PrintJSON display the install plan as JSON data.
+func (p *InstallPlan) PrintJSON(out io.Writer) error {
+	if p == nil {
+		return nil
+	}
+	jsonData, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Unable to encode in JSON. %s", err)
+	}
+	_, err = fmt.Fprintln(out, string(jsonData))
+	return err
+}
+
+/************************************************************************
+ ***************** INTERNAL FUNCTIONS ***********************************
+ ************************************************************************/
+
+// newPlanTransaction creates a transaction which only registers files. Nothing is staged on disk.
+func newPlanTransaction(homePath string) (t *installTransaction) {
+	t = new(installTransaction)
+	t.homePath = homePath
+	t.staged = make(map[string]bool)
+	t.kept = make(map[string]bool)
+	t.removed = make(map[string]bool)
+	return
+}
+
+// planPlugin add the plugin download, replace or keep action, and its states changes.
+// The download size is requested only if withSize is true.
+func (j *JenkinsHome) planPlugin(plan *InstallPlan, plugin *Plugin, installedElement Element, transaction *installTransaction, withSize bool) {
+	action := &InstallAction{Type: pluginType, Name: plugin.ExtensionName, Version: plugin.Version}
+	installedPlugin, _ := installedElement.(*Plugin)
+	if installedPlugin != nil {
+		action.InstalledVersion = installedPlugin.Version
+	}
+
+	archive, found := j.installedPlugin(plugin)
+	if found {
+		action.Action = PlanKeep
+		transaction.keep(path.Join(jenkinsHomePluginsPath, archive))
+	} else {
+		archive = path.Base(plugin.ExtensionName) + ".hpi"
+		action.Action = PlanDownload
+		if installedPlugin != nil {
+			action.Action = PlanReplace
+			if installedPlugin.Version == plugin.Version {
+				action.Reason = "sha256 differs or is unknown"
+			}
+		}
+		transaction.stage(path.Join(jenkinsHomePluginsPath, archive))
+
+		if withSize {
+			pluginObj := newPluginsStatusDetails()
+			pluginObj.setVersion(plugin.Version)
+			pluginObj.name = plugin.ExtensionName
+			action.Size = pluginObj.packageSize()
+			if action.Size < 0 {
+				plan.UnknownSizes++
+			} else {
+				plan.DownloadBytes += action.Size
+			}
+		}
+	}
+	action.File = path.Join(jenkinsHomePluginsPath, archive)
+	plan.Actions = append(plan.Actions, action)
+
+	for _, state := range plugin.states {
+		transaction.stage(path.Join(jenkinsHomePluginsPath, archive+"."+state))
+	}
+	for _, stateAction := range []struct{ state, set, unset string }{
+		{PluginDisabled, PlanDisable, PlanEnable},
+		{PluginPinned, PlanPin, PlanUnpin},
+	} {
+		wanted := plugin.hasState(stateAction.state)
+		current := installedPlugin.hasState(stateAction.state)
+		if wanted == current {
+			continue
+		}
+		stateChange := &InstallAction{Action: stateAction.unset, Type: pluginType, Name: plugin.ExtensionName,
+			File: path.Join(jenkinsHomePluginsPath, archive+"."+stateAction.state)}
+		if wanted {
+			stateChange.Action = stateAction.set
+		}
+		plan.Actions = append(plan.Actions, stateChange)
+	}
+}
+
+// planFile add the groovy or feature file add, update or keep action, comparing the installed file with the commit one.
+func (j *JenkinsHome) planFile(plan *InstallPlan, elementType, name, commit, file, sourcePath, sourceFile string, transaction *installTransaction) error {
+	data, err := gitShowFile(sourcePath, commit, sourceFile)
+	if err != nil {
+		return err
+	}
+	action := &InstallAction{Action: PlanAdd, Type: elementType, Name: name, Version: commit, File: file}
+	if installedSha, err := fileSha256(path.Join(j.homePath, file)); err == nil {
+		action.Action = PlanUpdate
+		if installedSha == dataSha256([]byte(data)) {
+			action.Action = PlanKeep
+		}
+	}
+	transaction.stage(file)
+	plan.Actions = append(plan.Actions, action)
+	return nil
+}
+
+// planRemovals add remove actions of plugins, groovies and files found by the transaction clean up.
+// States markers and jplugins internal files are ignored.
+// A plugin archive replaced by another one of the same plugin (`.jpi` by `.hpi`) is reported by the plugin action only.
+func (j *JenkinsHome) planRemovals(plan *InstallPlan, installedPlugins Elements, obsoletes map[string]bool, transaction *installTransaction) {
+	plannedPlugins := make(map[string]*InstallAction)
+	for _, action := range plan.Actions {
+		if action.Type == pluginType && (action.Action == PlanDownload || action.Action == PlanReplace || action.Action == PlanKeep) {
+			plannedPlugins[action.Name] = action
+		}
+	}
+
+	for _, file := range sortedKeys(transaction.removed) {
+		if _, err := os.Lstat(path.Join(j.homePath, file)); err != nil || file == jenkinsHomeFilesList {
+			continue
+		}
+		action := &InstallAction{Action: PlanRemove, File: file, Reason: "not in the lock file"}
+		dir, base := path.Split(file)
+		switch strings.TrimSuffix(dir, "/") {
+		case jenkinsHomePluginsPath:
+			ext := path.Ext(base)
+			if ext != ".hpi" && ext != ".jpi" {
+				continue // state marker
+			}
+			action.Type = pluginType
+			action.Name = strings.TrimSuffix(base, ext)
+			if pluginAction, found := plannedPlugins[action.Name]; found {
+				replaced := "replaces " + file
+				if pluginAction.Reason != "" {
+					replaced = pluginAction.Reason + ", " + replaced
+				}
+				pluginAction.Reason = replaced
+				continue
+			}
+			if installedPlugin, found := installedPlugins[action.Name]; found {
+				action.InstalledVersion = installedPlugin.(*Plugin).Version
+			}
+		case jenkinsHomeGroovyPath:
+			action.Type = groovyType
+			action.Name = strings.TrimSuffix(base, ".groovy")
+		case jenkinsHomeCascPath:
+			action.Type = cascType
+			action.Name = base
+		default:
+			action.Type = fileType
+			action.Name = file
+		}
+		if obsoletes[action.Type+":"+action.Name] {
+			action.Reason = "obsolete"
+		}
+		plan.Actions = append(plan.Actions, action)
+	}
+}
+
+// planSourcePath return the path of the features repository given.
+func (j *JenkinsHome) planSourcePath(elements *ElementsType, repoName, featureRepoPath string) (string, error) {
+	if repoName == "" {
+		return featureRepoPath, nil
+	}
+	repo, err := elements.getFeaturesRepo(repoName)
+	if err != nil {
+		return "", err
+	}
+	return repo.Path(), nil
+}
+
+func (p *InstallPlan) summary() string {
+	counts := make([]string, 0, 10)
+	for _, action := range []string{PlanDownload, PlanReplace, PlanKeep, PlanRemove, PlanAdd, PlanUpdate, PlanDisable, PlanEnable, PlanPin, PlanUnpin} {
+		if count := p.Count(action); count > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", count, action))
+		}
+	}
+	download := bytesString(p.DownloadBytes) + " to download"
+	if p.UnknownSizes > 0 {
+		download += fmt.Sprintf(" (%d size(s) unknown)", p.UnknownSizes)
+	}
+	if len(counts) == 0 {
+		return "Nothing to install. " + download + "."
+	}
+	return fmt.Sprintf("%d action(s): %s. %s.", len(p.Actions), strings.Join(counts, ", "), download)
+}
+
+// bytesString return a size in a human readable format.
+func bytesString(size int64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d %s", size, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
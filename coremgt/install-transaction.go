@@ -0,0 +1,244 @@
+package coremgt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/forj-oss/forjj-modules/trace"
+)
+
+const (
+	// jenkinsHomeStagingPath is the Jenkins home directory where files are prepared before being swapped.
+	jenkinsHomeStagingPath = ".jplugins-staging"
+	// jenkinsHomeBackupPath is the Jenkins home directory where replaced or removed files are moved during the swap.
+	jenkinsHomeBackupPath = ".jplugins-backup"
+)
+
+// installTransaction prepares files to install in a staging directory of the Jenkins home,
+// then swap them with the current files. If the swap fails, the previous installation is restored.
+//
+// Files are identified by their path relative to the Jenkins home.
+type installTransaction struct {
+	homePath    string
+	stagingPath string
+	backupPath  string
+	staged      map[string]bool // files written in the staging directory.
+	kept        map[string]bool // files already installed and up to date.
+	removed     map[string]bool // files to remove from the Jenkins home.
+	swapped     []swappedFile   // files replaced or removed, in order, to restore on failure.
+	keepBackup  bool            // true to keep the backup directory on close, if not saved as snapshot.
+}
+
+type swappedFile struct {
+	file    string
+	existed bool // true if the file has been moved to the backup directory.
+}
+
+func newInstallTransaction(homePath string) (t *installTransaction, err error) {
+	t = new(installTransaction)
+	t.homePath = homePath
+	t.stagingPath = path.Join(homePath, jenkinsHomeStagingPath)
+	t.backupPath = path.Join(homePath, jenkinsHomeBackupPath)
+	t.staged = make(map[string]bool)
+	t.kept = make(map[string]bool)
+	t.removed = make(map[string]bool)
+
+	// Files left in the backup directory were replaced by a previous install, but not saved in a snapshot.
+	// They are the only copy of the previous installation.
+	if entries, _ := ioutil.ReadDir(t.backupPath); len(entries) > 0 {
+		return nil, fmt.Errorf("'%s' contains files replaced by a previous install, not saved in a snapshot. "+
+			"Please restore or remove them before installing", t.backupPath)
+	}
+
+	// Staging and backup directories left by an interrupted install are not valid anymore.
+	for _, dir := range []string{t.stagingPath, t.backupPath} {
+		if err = os.RemoveAll(dir); err != nil {
+			return nil, fmt.Errorf("Unable to clean up '%s'. %s", dir, err)
+		}
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("Unable to create '%s'. %s", dir, err)
+		}
+	}
+	return
+}
+
+// stagingDir return the staging directory of a Jenkins home directory, created if missing.
+func (t *installTransaction) stagingDir(dir string) (stagingDir string, err error) {
+	stagingDir = path.Join(t.stagingPath, dir)
+	if err = os.MkdirAll(stagingDir, 0755); err != nil {
+		err = fmt.Errorf("Unable to create '%s'. %s", stagingDir, err)
+	}
+	return
+}
+
+// stage register a file written in the staging directory, to install.
+func (t *installTransaction) stage(file string) {
+	t.staged[file] = true
+}
+
+// stageData write data in the staging directory and register the file to install.
+func (t *installTransaction) stageData(file string, data []byte) error {
+	if _, err := t.stagingDir(path.Dir(file)); err != nil {
+		return err
+	}
+	stagingFile := path.Join(t.stagingPath, file)
+	if err := ioutil.WriteFile(stagingFile, data, 0644); err != nil {
+		return fmt.Errorf("Unable to write '%s'. %s", stagingFile, err)
+	}
+	t.stage(file)
+	return nil
+}
+
+// keep register a file already installed and up to date.
+func (t *installTransaction) keep(file string) {
+	t.kept[file] = true
+}
+
+// remove register a file to remove from the Jenkins home.
+func (t *installTransaction) remove(file string) {
+	t.removed[file] = true
+}
+
+// installed return true if the file is staged or kept.
+func (t *installTransaction) installed(file string) bool {
+	return t.staged[file] || t.kept[file]
+}
+
+// commit swap staged files with the Jenkins home ones, then remove files requested.
+// Staged files identical to the installed ones are not swapped.
+// On failure, the previous installation is restored.
+func (t *installTransaction) commit() (updated, removed int, err error) {
+	for _, file := range sortedKeys(t.staged) {
+		homeFile := path.Join(t.homePath, file)
+		stagingFile := path.Join(t.stagingPath, file)
+		if same, _ := sameFileContent(homeFile, stagingFile); same {
+			gotrace.Trace("Unchanged: %s", file)
+			continue
+		}
+		if err = t.backup(file); err != nil {
+			break
+		}
+		if err = os.MkdirAll(path.Dir(homeFile), 0755); err != nil {
+			err = fmt.Errorf("Unable to create '%s'. %s", path.Dir(homeFile), err)
+			break
+		}
+		if err = os.Rename(stagingFile, homeFile); err != nil {
+			err = fmt.Errorf("Unable to install '%s'. %s", file, err)
+			break
+		}
+		gotrace.Trace("Installed: %s", file)
+		updated++
+	}
+
+	if err == nil {
+		for _, file := range sortedKeys(t.removed) {
+			if t.installed(file) {
+				continue
+			}
+			if _, statErr := os.Lstat(path.Join(t.homePath, file)); os.IsNotExist(statErr) {
+				continue
+			}
+			if err = t.backup(file); err != nil {
+				break
+			}
+			gotrace.Trace("Removed: %s", file)
+			removed++
+		}
+	}
+
+	if err != nil {
+		if rollbackErr := t.rollback(); rollbackErr != nil {
+			err = fmt.Errorf("%s. Unable to restore the previous installation. %s", err, rollbackErr)
+		} else {
+			err = fmt.Errorf("%s. Previous installation restored", err)
+		}
+		return 0, 0, err
+	}
+	return
+}
+
+// close remove the staging and backup directories. The backup directory is kept if requested by keepBackup.
+func (t *installTransaction) close() {
+	if t == nil {
+		return
+	}
+	for _, dir := range []string{t.stagingPath, t.backupPath} {
+		if dir == t.backupPath && t.keepBackup {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			gotrace.Warning("Unable to remove '%s'. %s", dir, err)
+		}
+	}
+}
+
+/************************************************************************
+ ***************** INTERNAL FUNCTIONS ***********************************
+ ************************************************************************/
+
+// backup move the Jenkins home file to the backup directory, if it exists.
+func (t *installTransaction) backup(file string) error {
+	homeFile := path.Join(t.homePath, file)
+	if _, err := os.Lstat(homeFile); os.IsNotExist(err) {
+		t.swapped = append(t.swapped, swappedFile{file: file})
+		return nil
+	}
+
+	backupFile := path.Join(t.backupPath, file)
+	if err := os.MkdirAll(path.Dir(backupFile), 0755); err != nil {
+		return fmt.Errorf("Unable to create '%s'. %s", path.Dir(backupFile), err)
+	}
+	if err := os.Rename(homeFile, backupFile); err != nil {
+		return fmt.Errorf("Unable to backup '%s'. %s", file, err)
+	}
+	t.swapped = append(t.swapped, swappedFile{file: file, existed: true})
+	return nil
+}
+
+// rollback restore files swapped, in reverse order.
+func (t *installTransaction) rollback() (err error) {
+	for index := len(t.swapped) - 1; index >= 0; index-- {
+		swapped := t.swapped[index]
+		homeFile := path.Join(t.homePath, swapped.file)
+		if removeErr := os.Remove(homeFile); removeErr != nil && !os.IsNotExist(removeErr) {
+			err = fmt.Errorf("Unable to remove '%s'. %s", homeFile, removeErr)
+			continue
+		}
+		if !swapped.existed {
+			continue
+		}
+		if renameErr := os.Rename(path.Join(t.backupPath, swapped.file), homeFile); renameErr != nil {
+			err = fmt.Errorf("Unable to restore '%s'. %s", homeFile, renameErr)
+			continue
+		}
+		gotrace.Trace("Restored: %s", swapped.file)
+	}
+	t.swapped = nil
+	return
+}
+
+// sameFileContent return true if both files exist with the same sha256.
+func sameFileContent(file1, file2 string) (_ bool, err error) {
+	sha1, err := fileSha256(file1)
+	if err != nil {
+		return
+	}
+	sha2, err := fileSha256(file2)
+	if err != nil {
+		return
+	}
+	return sha1 == sha2, nil
+}
+
+// sortedKeys return the sorted list of keys of a map of flags.
+func sortedKeys(flags map[string]bool) (keys []string) {
+	keys = make([]string, 0, len(flags))
+	for key := range flags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
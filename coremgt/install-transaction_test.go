@@ -0,0 +1,160 @@
+package coremgt
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// newTestJenkinsHome creates a Jenkins home with the files given. (path => content)
+func newTestJenkinsHome(t *testing.T, files map[string]string) string {
+	homePath, err := ioutil.TempDir("", "jplugins-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, content := range files {
+		writeTestFile(t, path.Join(homePath, file), content)
+	}
+	return homePath
+}
+
+func writeTestFile(t *testing.T, file, content string) {
+	if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkTestFiles verify the content of files in the Jenkins home. An empty content means the file must not exist.
+func checkTestFiles(t *testing.T, homePath string, files map[string]string) {
+	for file, expected := range files {
+		data, err := ioutil.ReadFile(path.Join(homePath, file))
+		switch {
+		case expected == "" && err == nil:
+			t.Errorf("'%s' must not exist", file)
+		case expected == "":
+		case err != nil:
+			t.Errorf("'%s' is missing. %s", file, err)
+		case string(data) != expected:
+			t.Errorf("'%s' contains '%s', expected '%s'", file, data, expected)
+		}
+	}
+}
+
+func stageTestFiles(t *testing.T, transaction *installTransaction, files map[string]string) {
+	for file, content := range files {
+		if err := transaction.stageData(file, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestInstallTransactionCommit(t *testing.T) {
+	homePath := newTestJenkinsHome(t, map[string]string{
+		"plugins/git.hpi":           "git 1.0",
+		"plugins/credentials.hpi":   "credentials 1.0",
+		"plugins/old.hpi":           "old 1.0",
+		"init.groovy.d/ldap.groovy": "ldap",
+	})
+	defer os.RemoveAll(homePath)
+
+	transaction, err := newInstallTransaction(homePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stageTestFiles(t, transaction, map[string]string{
+		"plugins/git.hpi":           "git 2.0",
+		"plugins/new.hpi":           "new 1.0",
+		"init.groovy.d/ldap.groovy": "ldap",
+	})
+	transaction.keep("plugins/credentials.hpi")
+	transaction.remove("plugins/old.hpi")
+	transaction.remove("plugins/credentials.hpi")
+
+	updated, removed, err := transaction.commit()
+	if err != nil {
+		t.Fatalf("Commit failed. %s", err)
+	}
+	if updated != 2 || removed != 1 {
+		t.Errorf("Expected 2 files updated and 1 removed. Got %d updated and %d removed", updated, removed)
+	}
+	checkTestFiles(t, homePath, map[string]string{
+		"plugins/git.hpi":           "git 2.0",
+		"plugins/new.hpi":           "new 1.0",
+		"plugins/credentials.hpi":   "credentials 1.0",
+		"plugins/old.hpi":           "",
+		"init.groovy.d/ldap.groovy": "ldap",
+	})
+	checkTestFiles(t, transaction.backupPath, map[string]string{
+		"plugins/git.hpi": "git 1.0",
+		"plugins/old.hpi": "old 1.0",
+	})
+
+	transaction.close()
+	for _, dir := range []string{jenkinsHomeStagingPath, jenkinsHomeBackupPath} {
+		if _, err := os.Stat(path.Join(homePath, dir)); !os.IsNotExist(err) {
+			t.Errorf("'%s' not removed on close", dir)
+		}
+	}
+}
+
+func TestInstallTransactionRollback(t *testing.T) {
+	homePath := newTestJenkinsHome(t, map[string]string{
+		"plugins/git.hpi":  "git 1.0",
+		"plugins/old.hpi":  "old 1.0",
+		"plugins/blocking": "not a directory",
+	})
+	defer os.RemoveAll(homePath)
+
+	transaction, err := newInstallTransaction(homePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stageTestFiles(t, transaction, map[string]string{
+		"plugins/git.hpi": "git 2.0",
+		"plugins/new.hpi": "new 1.0",
+	})
+	transaction.remove("plugins/old.hpi")
+	// Removed after 'plugins/old.hpi'. 'plugins/blocking' is a file, so the backup fails.
+	transaction.remove("plugins/blocking/file")
+
+	if _, _, err = transaction.commit(); err == nil {
+		t.Fatal("Commit must fail")
+	}
+	transaction.close()
+
+	checkTestFiles(t, homePath, map[string]string{
+		"plugins/git.hpi":  "git 1.0",
+		"plugins/old.hpi":  "old 1.0",
+		"plugins/new.hpi":  "",
+		"plugins/blocking": "not a directory",
+	})
+	if _, err := os.Stat(path.Join(homePath, jenkinsHomeStagingPath)); !os.IsNotExist(err) {
+		t.Errorf("'%s' not removed after the rollback", jenkinsHomeStagingPath)
+	}
+}
+
+func TestInstallTransactionKeepBackup(t *testing.T) {
+	homePath := newTestJenkinsHome(t, map[string]string{"plugins/git.hpi": "git 1.0"})
+	defer os.RemoveAll(homePath)
+
+	transaction, err := newInstallTransaction(homePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stageTestFiles(t, transaction, map[string]string{"plugins/git.hpi": "git 2.0"})
+	if _, _, err = transaction.commit(); err != nil {
+		t.Fatalf("Commit failed. %s", err)
+	}
+	transaction.keepBackup = true
+	transaction.close()
+	checkTestFiles(t, path.Join(homePath, jenkinsHomeBackupPath), map[string]string{"plugins/git.hpi": "git 1.0"})
+
+	// Replaced files not saved must be handled before the next install.
+	if _, err = newInstallTransaction(homePath); err == nil {
+		t.Errorf("A new transaction must be refused while '%s' is not empty", jenkinsHomeBackupPath)
+	}
+}
@@ -0,0 +1,296 @@
+package coremgt
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"jplugins/simplefile"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/forj-oss/forjj-modules/trace"
+	goversion "github.com/hashicorp/go-version"
+)
+
+const (
+	jenkinsType = "jenkins"
+	// JenkinsWarRepo is the war mirror path on the updates server. (`<repo>/<version>/jenkins.war`)
+	JenkinsWarRepo = "download/war"
+	// jenkinsWarTmpSuffix is the suffix of the war downloaded next to the installed one, before the swap.
+	jenkinsWarTmpSuffix = ".jplugins-tmp"
+)
+
+// JenkinsCore is the Jenkins core version locked with plugins. (`jenkins:<version>:<sha256>`)
+type JenkinsCore struct {
+	Version    string
+	Sha256     string // base64 sha256 of the war. Empty if unknown.
+	url        string // URL of the war. The war mirror is used if empty.
+	noChecksum bool   // true to accept a war without sha256 locked.
+}
+
+// RepositoryCore is the Jenkins core entry of the updates center.
+type RepositoryCore struct {
+	Name    string
+	Version string
+	Sha256  string `json:"sha256"`
+	URL     string `json:"url"`
+}
+
+// NewJenkinsCore return a JenkinsCore object
+func NewJenkinsCore(version, sha256 string) (ret *JenkinsCore) {
+	ret = new(JenkinsCore)
+	ret.Version = version
+	ret.Sha256 = sha256
+	return
+}
+
+// String return the string representation of the Jenkins core
+func (c *JenkinsCore) String() string {
+	if c == nil {
+		return "nil"
+	}
+	return jenkinsType + ":" + c.Version
+}
+
+// URL return the URL of the Jenkins war.
+func (c *JenkinsCore) URL() string {
+	if c == nil {
+		return ""
+	}
+	if c.url != "" {
+		return c.url
+	}
+	return JenkinsRepoURL + "/" + JenkinsWarRepo + "/" + c.Version + "/jenkins.war"
+}
+
+// SetNoChecksum accept to download a war without sha256 locked. The war is then not verified.
+func (c *JenkinsCore) SetNoChecksum() {
+	if c == nil {
+		return
+	}
+	c.noChecksum = true
+}
+
+// CheckRequiredCore return an error if the core version is lower than the core required by a plugin.
+func (c *JenkinsCore) CheckRequiredCore(name, version, requiredCore string) error {
+	if c == nil || requiredCore == "" {
+		return nil
+	}
+	coreVersion, err := goversion.NewVersion(c.Version)
+	if err != nil {
+		return fmt.Errorf("Invalid Jenkins core version '%s'. %s", c.Version, err)
+	}
+	required, err := goversion.NewVersion(requiredCore)
+	if err != nil {
+		gotrace.Warning("Invalid core version '%s' required by %s %s. Not verified.", requiredCore, name, version)
+		return nil
+	}
+	if coreVersion.LessThan(required) {
+		return fmt.Errorf("Plugin %s %s requires Jenkins %s or higher. Locked Jenkins core is %s", name, version, requiredCore, c.Version)
+	}
+	return nil
+}
+
+// DownloadWar download the Jenkins war next to warFile and verify its sha256.
+// It returns the file downloaded, to install with InstallWar. It returns an empty string if warFile is already up to date.
+// Without sha256 locked, it fails, except if SetNoChecksum was called.
+func (c *JenkinsCore) DownloadWar(warFile string) (downloaded string, err error) {
+	if c == nil {
+		return
+	}
+	if c.Sha256 == "" && !c.noChecksum {
+		return "", fmt.Errorf("Jenkins %s war sha256 is not locked. Unable to verify the war", c.Version)
+	}
+	if c.Sha256 != "" {
+		if installedSha, err := fileSha256(warFile); err == nil && installedSha == c.Sha256 {
+			gotrace.Trace("%s is up to date.", warFile)
+			return "", nil
+		}
+	}
+	if err = os.MkdirAll(path.Dir(warFile), 0755); err != nil {
+		return "", fmt.Errorf("Unable to create '%s'. %s", path.Dir(warFile), err)
+	}
+
+	downloaded = warFile + jenkinsWarTmpSuffix
+	downloadedSha, err := httpDownload(c.URL(), downloaded)
+	if err != nil {
+		os.Remove(downloaded)
+		return "", fmt.Errorf("Unable to download Jenkins %s. %s", c.Version, err)
+	}
+	if c.Sha256 == "" {
+		gotrace.Warning("%s checksum not checked, as requested.", c.URL())
+		c.Sha256 = downloadedSha
+	} else if downloadedSha != c.Sha256 {
+		os.Remove(downloaded)
+		return "", fmt.Errorf("Jenkins %s war has an invalid check sum. Expect '%s'. Got '%s'", c.Version, c.Sha256, downloadedSha)
+	}
+	gotrace.Trace("Copied: %s => %s - sha256:%s", c.URL(), downloaded, downloadedSha)
+	return
+}
+
+// InstallWar replace warFile by the war downloaded by DownloadWar.
+func (c *JenkinsCore) InstallWar(downloaded, warFile string) error {
+	if c == nil || downloaded == "" {
+		return nil
+	}
+	if err := os.Rename(downloaded, warFile); err != nil {
+		os.Remove(downloaded)
+		return fmt.Errorf("Unable to install '%s'. %s", warFile, err)
+	}
+	return nil
+}
+
+// GetCore return the Jenkins core of the version given, as described by Jenkins updates.
+// An empty version or "latest" selects the core of the updates center.
+// For other versions, the sha256 is read from the war mirror. It fails if no sha256 is found.
+func (r *Repository) GetCore(version string) (core *JenkinsCore, err error) {
+	if r == nil {
+		return
+	}
+	if version == "" || version == "latest" {
+		if r.Core.Version == "" {
+			return nil, fmt.Errorf("No Jenkins core found in '%s'", r.repoFile)
+		}
+		version = r.Core.Version
+	}
+	if _, err = goversion.NewVersion(version); err != nil {
+		return nil, fmt.Errorf("Invalid Jenkins core version '%s'. %s", version, err)
+	}
+
+	core = NewJenkinsCore(version, "")
+	if version == r.Core.Version {
+		if r.Core.Sha256 == "" {
+			return nil, fmt.Errorf("No sha256 for Jenkins %s in '%s'", version, r.repoFile)
+		}
+		core.Sha256 = r.Core.Sha256
+		core.url = r.Core.URL
+		return
+	}
+
+	if core.Sha256, err = warMirrorSha256(core.URL()); err != nil {
+		return nil, fmt.Errorf("Unable to get Jenkins %s war sha256 from '%s.sha256'. %s", version, core.URL(), err)
+	}
+	return
+}
+
+// SetJenkinsCore lock the Jenkins core version given. (`jenkins:<version>`)
+// An empty version or "latest" selects the core of the updates center.
+func (s *PluginsStatus) SetJenkinsCore(version string) (err error) {
+	if s == nil {
+		return
+	}
+	s.core, err = s.ref.GetCore(version)
+	return
+}
+
+// CheckJenkinsCore verify the core required by each plugin is satisfied by the Jenkins core locked.
+func (s *PluginsStatus) CheckJenkinsCore() (_ bool) {
+	if s == nil {
+		return
+	}
+	if s.core == nil {
+		return true
+	}
+	ret := true
+	for name, plugin := range s.plugins {
+		refPlugin, found := s.ref.Get(name, plugin.newVersion.String())
+		if !found {
+			continue
+		}
+		if err := s.core.CheckRequiredCore(name, plugin.newVersion.String(), refPlugin.JenkinsVersion); err != nil {
+			gotrace.Error("%s", err)
+			ret = false
+		}
+	}
+	return ret
+}
+
+// JenkinsCore return the Jenkins core locked. nil if not locked.
+func (e *ElementsType) JenkinsCore() *JenkinsCore {
+	if e == nil {
+		return nil
+	}
+	return e.core
+}
+
+// CheckJenkinsCore verify the core required by each plugin is satisfied by the Jenkins core locked.
+// It requires the repository. (SetRepository)
+func (e *ElementsType) CheckJenkinsCore() (errors []string) {
+	if e == nil || e.core == nil {
+		return
+	}
+	for name, element := range e.list[pluginType] {
+		plugin, ok := element.(*Plugin)
+		if !ok || plugin.Version == "" {
+			continue
+		}
+		refPlugin, found := e.ref.Get(name, plugin.Version)
+		if !found {
+			continue
+		}
+		if err := e.core.CheckRequiredCore(name, plugin.Version, refPlugin.JenkinsVersion); err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+	return
+}
+
+/************************************************************************
+ ***************** INTERNAL FUNCTIONS ***********************************
+ ************************************************************************/
+
+// setJenkinsCore set the Jenkins core from lock file fields. (`jenkins:<version>[:<sha256>]`)
+func (e *ElementsType) setJenkinsCore(fields []string) error {
+	if len(fields) < 2 || fields[1] == "" {
+		return fmt.Errorf("Invalid format. Expect '%s:<version>[:<sha256>]'", jenkinsType)
+	}
+	sha256 := ""
+	if len(fields) >= 3 {
+		sha256 = fields[2]
+	}
+	e.core = NewJenkinsCore(fields[1], sha256)
+	return nil
+}
+
+// addToLockFile add the Jenkins core record to the lock file data.
+func (c *JenkinsCore) addToLockFile(lockFile *simplefile.SimpleFile) {
+	if c == nil {
+		return
+	}
+	lockFile.AddWithKeyString("0-"+jenkinsType, c.lockFields()...)
+}
+
+// lockFields return the lock file record fields of the Jenkins core.
+func (c *JenkinsCore) lockFields() []string {
+	if c == nil {
+		return nil
+	}
+	return []string{jenkinsType, c.Version, c.Sha256}
+}
+
+// warMirrorSha256 read the war checksum published by the mirror (`<war url>.sha256`) and return it as base64.
+func warMirrorSha256(warURL string) (_ string, err error) {
+	resp, err := httpRequest("GET", warURL+".sha256")
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("%s", resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("Empty checksum file")
+	}
+	sha, err := hex.DecodeString(fields[0])
+	if err != nil {
+		return "", fmt.Errorf("Invalid checksum '%s'. %s", fields[0], err)
+	}
+	return base64.StdEncoding.EncodeToString(sha), nil
+}
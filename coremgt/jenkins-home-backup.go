@@ -0,0 +1,249 @@
+package coremgt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/forj-oss/forjj-modules/trace"
+)
+
+const (
+	// DefaultBackups is the default number of snapshots kept in the backup directory.
+	DefaultBackups = 5
+
+	// jenkinsHomeBackupsPath is the default backup directory, in the Jenkins home.
+	jenkinsHomeBackupsPath = ".jplugins-backups"
+	// jenkinsHomeInstalledLock is the copy of the lock file installed, saved in snapshots when replaced.
+	jenkinsHomeInstalledLock = ".jplugins-installed.lock"
+	// snapshotAddedList lists files added by the install, to remove them on rollback.
+	snapshotAddedList  = ".jplugins-added"
+	snapshotTimeFormat = "20060102-150405"
+)
+
+// SetBackup configure snapshots saved by Install. An empty backupPath means `<jenkins home>/.jplugins-backups`.
+// keep is the number of snapshots kept. 0 disables snapshots.
+func (j *JenkinsHome) SetBackup(backupPath string, keep int) {
+	if j == nil {
+		return
+	}
+	j.backupPath = backupPath
+	j.backups = keep
+}
+
+// SetLockFile set the lock file installed. It is copied in the Jenkins home, to be saved with the next snapshot.
+func (j *JenkinsHome) SetLockFile(lockFile string) {
+	if j == nil {
+		return
+	}
+	j.lockFile = lockFile
+}
+
+// BackupPath return the directory where snapshots are saved.
+func (j *JenkinsHome) BackupPath() string {
+	if j == nil {
+		return ""
+	}
+	if j.backupPath == "" {
+		return path.Join(j.homePath, jenkinsHomeBackupsPath)
+	}
+	return j.backupPath
+}
+
+// Snapshots return the list of snapshots saved, oldest first.
+func (j *JenkinsHome) Snapshots() (snapshots []string, err error) {
+	if j == nil {
+		return
+	}
+	entries, err := ioutil.ReadDir(j.BackupPath())
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the backup directory '%s'. %s", j.BackupPath(), err)
+	}
+	snapshots = make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			snapshots = append(snapshots, entry.Name())
+		}
+	}
+	sort.Strings(snapshots)
+	return
+}
+
+// Rollback restore the Jenkins home as it was before the snapshot given was taken.
+// All installs done after it are undone too. If to is empty, the latest install is undone.
+// It returns the list of snapshots restored, latest first. They are removed from the backup directory.
+func (j *JenkinsHome) Rollback(to string) (restored []string, err error) {
+	if j == nil {
+		return
+	}
+	snapshots, err := j.Snapshots()
+	if err != nil {
+		return
+	}
+	if len(snapshots) == 0 {
+		return nil, fmt.Errorf("No snapshot found in '%s'", j.BackupPath())
+	}
+	if to == "" {
+		to = snapshots[len(snapshots)-1]
+	}
+	index := sort.SearchStrings(snapshots, to)
+	if index == len(snapshots) || snapshots[index] != to {
+		return nil, fmt.Errorf("Snapshot '%s' not found. Available: %s", to, strings.Join(snapshots, ", "))
+	}
+	for current := len(snapshots) - 1; current >= index; current-- {
+		restored = append(restored, snapshots[current])
+	}
+
+	transaction, err := newInstallTransaction(j.homePath)
+	if err != nil {
+		return nil, err
+	}
+	defer transaction.close()
+
+	// Snapshots are restored from the latest to the oldest, so the oldest content of a file wins.
+	for _, snapshot := range restored {
+		if err = j.stageSnapshot(path.Join(j.BackupPath(), snapshot), transaction); err != nil {
+			return nil, err
+		}
+	}
+
+	updated, removed, err := transaction.commit()
+	if err != nil {
+		return nil, err
+	}
+	gotrace.Info("Jenkins home restored: %d file(s) installed, %d file(s) removed.", updated, removed)
+
+	for _, snapshot := range restored {
+		if err := os.RemoveAll(path.Join(j.BackupPath(), snapshot)); err != nil {
+			gotrace.Warning("Unable to remove snapshot '%s'. %s", snapshot, err)
+		}
+	}
+	return
+}
+
+/************************************************************************
+ ***************** INTERNAL FUNCTIONS ***********************************
+ ************************************************************************/
+
+// saveSnapshot move files replaced or removed by the transaction to a new snapshot, with the list of files added.
+// Oldest snapshots are removed to keep the number of snapshots configured.
+func (j *JenkinsHome) saveSnapshot(transaction *installTransaction) (snapshot string, err error) {
+	if j.backups <= 0 || len(transaction.swapped) == 0 {
+		return
+	}
+
+	added := make([]string, 0, len(transaction.swapped))
+	for _, swapped := range transaction.swapped {
+		if !swapped.existed {
+			added = append(added, swapped.file)
+		}
+	}
+	sort.Strings(added)
+	if err = ioutil.WriteFile(path.Join(transaction.backupPath, snapshotAddedList), []byte(strings.Join(added, "\n")+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("Unable to write the snapshot files list. %s", err)
+	}
+
+	if err = os.MkdirAll(j.BackupPath(), 0755); err != nil {
+		return "", fmt.Errorf("Unable to create '%s'. %s", j.BackupPath(), err)
+	}
+	snapshot = time.Now().Format(snapshotTimeFormat)
+	for index := 2; ; index++ {
+		if _, statErr := os.Stat(path.Join(j.BackupPath(), snapshot)); os.IsNotExist(statErr) {
+			break
+		}
+		snapshot = fmt.Sprintf("%s-%d", time.Now().Format(snapshotTimeFormat), index)
+	}
+	if err = moveDir(transaction.backupPath, path.Join(j.BackupPath(), snapshot)); err != nil {
+		return "", fmt.Errorf("Unable to save snapshot '%s'. %s", snapshot, err)
+	}
+
+	j.pruneSnapshots()
+	return
+}
+
+// pruneSnapshots remove oldest snapshots over the number of snapshots to keep.
+func (j *JenkinsHome) pruneSnapshots() {
+	snapshots, err := j.Snapshots()
+	if err != nil {
+		gotrace.Warning("%s", err)
+		return
+	}
+	for index := 0; index < len(snapshots)-j.backups; index++ {
+		if err := os.RemoveAll(path.Join(j.BackupPath(), snapshots[index])); err != nil {
+			gotrace.Warning("Unable to remove snapshot '%s'. %s", snapshots[index], err)
+			continue
+		}
+		gotrace.Trace("Snapshot '%s' removed.", snapshots[index])
+	}
+}
+
+// stageSnapshot prepare the transaction to restore files saved in the snapshot and remove files it added.
+func (j *JenkinsHome) stageSnapshot(snapshotPath string, transaction *installTransaction) error {
+	data, err := ioutil.ReadFile(path.Join(snapshotPath, snapshotAddedList))
+	if err != nil {
+		return fmt.Errorf("Invalid snapshot '%s'. %s", path.Base(snapshotPath), err)
+	}
+	for _, file := range strings.Split(string(data), "\n") {
+		if file = strings.Trim(file, " "); file == "" {
+			continue
+		}
+		delete(transaction.staged, file)
+		transaction.remove(file)
+	}
+
+	return filepath.Walk(snapshotPath, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relFile, _ := filepath.Rel(snapshotPath, file)
+		if relFile == snapshotAddedList {
+			return nil
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("Unable to read '%s'. %s", file, err)
+		}
+		delete(transaction.removed, relFile)
+		return transaction.stageData(relFile, data)
+	})
+}
+
+// moveDir rename a directory. If source and destination are on different file systems, it is copied then removed.
+func moveDir(source, dest string) (err error) {
+	if err = os.Rename(source, dest); err == nil {
+		return
+	}
+	gotrace.Trace("Unable to rename '%s' to '%s'. %s. Copying it.", source, dest, err)
+
+	err = filepath.Walk(source, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relFile, _ := filepath.Rel(source, file)
+		destFile := path.Join(dest, relFile)
+		if info.IsDir() {
+			return os.MkdirAll(destFile, 0755)
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(destFile, data, info.Mode())
+	})
+	if err != nil {
+		os.RemoveAll(dest)
+		return
+	}
+	return os.RemoveAll(source)
+}
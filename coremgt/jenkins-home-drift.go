@@ -0,0 +1,236 @@
+package coremgt
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/forj-oss/forjj-modules/trace"
+)
+
+// Drift kinds between the lock file and the Jenkins home.
+const (
+	DriftMissing   = "missing"   // Element locked, but not installed.
+	DriftExtra     = "extra"     // Plugin installed, but not locked.
+	DriftVersion   = "version"   // Plugin installed with another version.
+	DriftSha256    = "sha256"    // Plugin installed with the version locked, but another content.
+	DriftState     = "state"     // Plugin disabled or pinned state differs.
+	DriftModified  = "modified"  // Groovy or file installed with another content.
+	DriftUnmanaged = "unmanaged" // Groovy or file installed, but not in the lock file.
+)
+
+// DriftItem is a difference between an element of the lock file and the Jenkins home.
+type DriftItem struct {
+	Drift            string
+	Type             string
+	Name             string
+	Version          string // Plugin version or commit ID locked.
+	InstalledVersion string // Plugin version installed.
+	Reason           string
+}
+
+// Drift is the list of differences between the lock file and what is installed in a Jenkins home.
+// It reveals changes applied by hand or by Jenkins itself since the last `jplugins install`.
+type Drift struct {
+	JenkinsHome string
+	Items       []*DriftItem
+}
+
+// CheckDrift compare plugins, groovies and files installed in the Jenkins home with the lock file elements.
+// Plugins sha256 are verified only if known by the repository.
+func (j *JenkinsHome) CheckDrift(elements *ElementsType, featureRepoPath string) (drift *Drift, err error) {
+	plan, err := j.plan(elements, featureRepoPath, false)
+	if err != nil {
+		return
+	}
+	lockedPlugins := elements.GetElements(pluginType)
+
+	drift = newDrift(j.homePath)
+	missing := make(map[string]bool)
+	for _, action := range plan.Actions {
+		item := &DriftItem{Type: action.Type, Name: action.Name, Version: action.Version, InstalledVersion: action.InstalledVersion}
+		switch action.Action {
+		case PlanKeep:
+			continue
+		case PlanDownload, PlanAdd:
+			item.Drift = DriftMissing
+			missing[action.Type+":"+action.Name] = true
+		case PlanReplace:
+			item.Drift = DriftVersion
+			if action.InstalledVersion == action.Version {
+				plugin, _ := lockedPlugins[action.Name].(*Plugin)
+				if plugin == nil || plugin.checkSumSha256 == "" {
+					gotrace.Trace("%s %s sha256 is unknown. Not verified.", action.Name, action.Version)
+					continue
+				}
+				item.Drift = DriftSha256
+				item.Reason = "installed content differs from the updates center one"
+			}
+		case PlanUpdate:
+			item.Drift = DriftModified
+		case PlanRemove:
+			item.Drift = DriftUnmanaged
+			if action.Type == pluginType {
+				if plugin, ok := lockedPlugins[action.Name].(*Plugin); ok && plugin.Version != "" {
+					// Archive replaced by the locked plugin one. Already reported.
+					continue
+				}
+				item.Drift = DriftExtra
+			}
+			item.Reason = action.Reason
+		case PlanDisable, PlanEnable, PlanPin, PlanUnpin:
+			if missing[action.Type+":"+action.Name] {
+				continue
+			}
+			item.Drift = DriftState
+			item.Reason = stateDriftReason(action.Action)
+		}
+		drift.Items = append(drift.Items, item)
+	}
+	return
+}
+
+// NewPluginsDrift compare plugins installed (read from a running Jenkins) with the lock file plugins.
+// Without files access, plugins sha256, groovies and files are not compared.
+func NewPluginsDrift(jenkins string, locked, installed *ElementsType) (drift *Drift) {
+	drift = newDrift(jenkins)
+	lockedPlugins := locked.GetElements(pluginType)
+	installedPlugins := installed.GetElements(pluginType)
+
+	for _, name := range sortedElementNames(lockedPlugins) {
+		plugin, ok := lockedPlugins[name].(*Plugin)
+		if !ok || plugin.Version == "" {
+			continue
+		}
+		item := &DriftItem{Type: pluginType, Name: name, Version: plugin.Version}
+		installedPlugin, _ := installedPlugins[name].(*Plugin)
+		if installedPlugin == nil {
+			item.Drift = DriftMissing
+			drift.Items = append(drift.Items, item)
+			continue
+		}
+		item.InstalledVersion = installedPlugin.Version
+		if installedPlugin.Version != plugin.Version {
+			item.Drift = DriftVersion
+			drift.Items = append(drift.Items, item)
+		}
+		for _, stateAction := range []struct{ state, set, unset string }{
+			{PluginDisabled, PlanDisable, PlanEnable},
+			{PluginPinned, PlanPin, PlanUnpin},
+		} {
+			wanted := plugin.hasState(stateAction.state)
+			if wanted == installedPlugin.hasState(stateAction.state) {
+				continue
+			}
+			action := stateAction.unset
+			if wanted {
+				action = stateAction.set
+			}
+			drift.Items = append(drift.Items, &DriftItem{Drift: DriftState, Type: pluginType, Name: name, Reason: stateDriftReason(action)})
+		}
+	}
+
+	for _, name := range sortedElementNames(installedPlugins) {
+		if plugin, ok := lockedPlugins[name].(*Plugin); ok && plugin.Version != "" {
+			continue
+		}
+		installedPlugin := installedPlugins[name].(*Plugin)
+		drift.Items = append(drift.Items, &DriftItem{Drift: DriftExtra, Type: pluginType, Name: name,
+			InstalledVersion: installedPlugin.Version, Reason: "not in the lock file"})
+	}
+	return
+}
+
+// Length return the number of differences found.
+func (d *Drift) Length() int {
+	if d == nil {
+		return 0
+	}
+	return len(d.Items)
+}
+
+// Count return the number of differences of the kind given.
+func (d *Drift) Count(kind string) (count int) {
+	if d == nil {
+		return
+	}
+	for _, item := range d.Items {
+		if item.Drift == kind {
+			count++
+		}
+	}
+	return
+}
+
+// PrintText display the differences found.
+func (d *Drift) PrintText(out io.Writer) {
+	if d == nil {
+		return
+	}
+	fmt.Fprintf(out, "Drift of %s from the lock file\n", d.JenkinsHome)
+
+	iMaxName := 0
+	for _, item := range d.Items {
+		if size := len(item.Type) + len(item.Name) + 1; size > iMaxName {
+			iMaxName = size
+		}
+	}
+	nameFormat := "%-9s %-" + strconv.Itoa(iMaxName) + "s : "
+	for _, item := range d.Items {
+		fmt.Fprintf(out, nameFormat, item.Drift, item.Type+":"+item.Name)
+		details := make([]string, 0, 2)
+		switch {
+		case item.InstalledVersion != "" && item.Version != "" && item.InstalledVersion != item.Version:
+			details = append(details, item.InstalledVersion+" installed, "+item.Version+" locked")
+		case item.Version != "":
+			details = append(details, item.Version)
+		case item.InstalledVersion != "":
+			details = append(details, item.InstalledVersion)
+		}
+		if item.Reason != "" {
+			details = append(details, "- "+item.Reason)
+		}
+		fmt.Fprintln(out, strings.Join(details, " "))
+	}
+	fmt.Fprintf(out, "\n%s\n", d.summary())
+}
+
+/************************************************************************
+ ***************** INTERNAL FUNCTIONS ***********************************
+ ************************************************************************/
+
+func newDrift(jenkinsHome string) (d *Drift) {
+	d = new(Drift)
+	d.JenkinsHome = jenkinsHome
+	d.Items = make([]*DriftItem, 0)
+	return
+}
+
+// stateDriftReason describe the state difference corresponding to the install plan state action.
+func stateDriftReason(action string) string {
+	switch action {
+	case PlanDisable:
+		return "enabled, locked as disabled"
+	case PlanEnable:
+		return "disabled, locked as enabled"
+	case PlanPin:
+		return "not pinned, locked as pinned"
+	case PlanUnpin:
+		return "pinned, not locked as pinned"
+	}
+	return action
+}
+
+func (d *Drift) summary() string {
+	if len(d.Items) == 0 {
+		return "No drift detected."
+	}
+	counts := make([]string, 0, 7)
+	for _, kind := range []string{DriftMissing, DriftExtra, DriftVersion, DriftSha256, DriftState, DriftModified, DriftUnmanaged} {
+		if count := d.Count(kind); count > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", count, kind))
+		}
+	}
+	return fmt.Sprintf("%d drift(s): %s.", len(d.Items), strings.Join(counts, ", "))
+}
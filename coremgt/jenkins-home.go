@@ -12,32 +12,75 @@ import (
 	"strings"
 
 	"github.com/forj-oss/forjj-modules/trace"
-	forjjutils "github.com/forj-oss/utils"
-	yaml "gopkg.in/yaml.v2"
 )
 
 const (
 	jenkinsHomeGroovyPath  = "init.groovy.d"
 	jenkinsHomePluginsPath = "plugins"
+	jenkinsHomeCascPath    = "casc_configs"
+	// jenkinsHomeFilesList lists files installed by features (file type), to remove them on next install.
+	jenkinsHomeFilesList = ".jplugins-files"
 )
 
 // JenkinsHome represents the Jenkins home where we install or identify plugins
 type JenkinsHome struct {
-	homePath string
+	homePath   string
+	backupPath string // Directory of snapshots. Empty for the Jenkins home default one.
+	backups    int    // Number of snapshots to keep.
+	lockFile   string // Lock file installed.
+	jobs       int    // Number of plugins downloaded in parallel.
+	cache      *PluginsCache
 }
 
 // NewJenkinsHome creates a new JenkinsHome object
 func NewJenkinsHome(jenkinsHomePath string) (ret *JenkinsHome) {
 	ret = new(JenkinsHome)
 	ret.homePath = jenkinsHomePath
+	ret.backups = DefaultBackups
+	ret.jobs = DefaultJobs
 	return ret
 }
 
+// SetCache set the plugins cache used by Install. nil disables the cache.
+func (j *JenkinsHome) SetCache(cache *PluginsCache) {
+	if j == nil {
+		return
+	}
+	j.cache = cache
+}
+
+// SetJobs set the number of plugins downloaded in parallel by Install.
+func (j *JenkinsHome) SetJobs(jobs int) {
+	if j == nil {
+		return
+	}
+	j.jobs = jobs
+}
+
 // Install execute an installation of plugins/groovies to the right path.
+//
+// Plugins already installed with the expected sha256 are kept. Other elements are prepared in a staging directory,
+// then swapped with the installed ones. Plugins, groovies and files not in the list anymore are removed.
+// Any failure leaves the previous installation intact.
+//
+// Files replaced or removed are saved in a snapshot, with the previous lock file installed. (see Rollback)
 func (j *JenkinsHome) Install(elements *ElementsType, featureRepoPath string) error {
-
-	j.cleanUp()
-	return j.install(elements, featureRepoPath)
+	if err := elements.SetFeaturesPath(featureRepoPath); err != nil {
+		return err
+	}
+	return j.runInstall(func(transaction *installTransaction) error {
+		if err := j.install(elements, featureRepoPath, transaction); err != nil {
+			return err
+		}
+		if j.lockFile == "" {
+			return nil
+		}
+		data, err := ioutil.ReadFile(j.lockFile)
+		if err != nil {
+			return fmt.Errorf("Unable to read '%s'. %s", j.lockFile, err)
+		}
+		return transaction.stageData(jenkinsHomeInstalledLock, data)
+	})
 }
 
 // IsValid is true if Jenkins home and sub
@@ -61,7 +104,7 @@ func (j *JenkinsHome) GetPlugins() (elements *ElementsType, _ error) {
 	pluginsPath := path.Join(j.homePath, jenkinsHomePluginsPath)
 
 	elements = NewElementsType()
-	elements.noRecursiveChain()
+	elements.NoRecursiveChain()
 
 	fEntries, err := ioutil.ReadDir(pluginsPath)
 
@@ -69,22 +112,11 @@ func (j *JenkinsHome) GetPlugins() (elements *ElementsType, _ error) {
 		return nil, fmt.Errorf("Invalid Jenkins home '%s'. %s", pluginsPath, err)
 	}
 
-	var fileRE, manifestRE *regexp.Regexp
 	fileREDefine := `^(.*)(\.[jh]pi)$`
-	manifestREDefine := `([\w-]*: )(.*)\n`
-
-	if re, err := regexp.Compile(fileREDefine); err != nil {
-		gotrace.Error("Internal error. Regex '%s': %s", fileREDefine, err)
-		return
-	} else {
-		fileRE = re
-
-	}
-	if re, err := regexp.Compile(manifestREDefine); err != nil {
+	fileRE, err := regexp.Compile(fileREDefine)
+	if err != nil {
 		gotrace.Error("Internal error. Regex '%s': %s", fileREDefine, err)
 		return
-	} else {
-		manifestRE = re
 	}
 
 	for _, fEntry := range fEntries {
@@ -95,50 +127,21 @@ func (j *JenkinsHome) GetPlugins() (elements *ElementsType, _ error) {
 		if fileMatch := fileRE.FindAllStringSubmatch(fEntry.Name(), -1); fileMatch != nil {
 			pluginFileName := fileMatch[0][0]
 			pluginName := fileMatch[0][1]
-			pluginExt := fileMatch[0][2]
 
 			if pluginFileName != "" && pluginName == "" {
 				gotrace.Error("Invalid file '%s'. Ignored.", pluginFileName)
 				continue
 			}
 
-			pluginMetafile := path.Join(pluginsPath, pluginName, "META-INF", "MANIFEST.MF")
-
-			tmpExtract := false
-			packagePath := path.Join(pluginsPath, pluginName)
-			if _, err := os.Stat(pluginMetafile); err != nil && os.IsNotExist(err) {
-				if _, s := forjjutils.RunCmdOutput("unzip", "-q", packagePath+pluginExt, "META-INF/MANIFEST.MF", "-d", packagePath); s != 0 {
-					gotrace.Error("Unable to extract MANIFEST.MF from plugin package %s", pluginName)
-					continue
-				}
-				tmpExtract = true
-			}
-
-			var manifest *Plugin
-
-			if d, err := ioutil.ReadFile(pluginMetafile); err != nil {
-				gotrace.Error("Unable to read file '%s'. %s. Ignored", pluginMetafile, err)
+			manifest, err := readPluginManifest(path.Join(pluginsPath, pluginFileName), path.Join(pluginsPath, pluginName))
+			if err != nil {
+				gotrace.Error("%s. Ignored", err)
 				continue
-			} else {
-				// Remove DOS format if exist
-				data := strings.Replace(string(d), "\r", "", -1)
-				// and remove new lines ('\n ')
-				data = strings.Replace(data, "\n ", "", -1)
-				// and escape "
-				data = strings.Replace(data, "\"", "\\\"", -1)
-				// and embrace value part with "
-				data = manifestRE.ReplaceAllString(data, `$1"$2"`+"\n")
-
-				manifest = NewPlugin()
-				if err := yaml.Unmarshal([]byte(data), &manifest); err != nil {
-					gotrace.Error("Unable to read file '%s' as yaml. %s. Ignored", pluginMetafile, err)
-					fmt.Print(data)
-					continue
-				}
 			}
-			if tmpExtract {
-				os.RemoveAll(packagePath)
-				tmpExtract = false
+			for _, state := range []string{PluginDisabled, PluginPinned} {
+				if _, err := os.Stat(path.Join(pluginsPath, pluginFileName+"."+state)); err == nil {
+					manifest.addState(state)
+				}
 			}
 			if _, err = elements.AddElement(manifest); err != nil {
 				return nil, err
@@ -152,44 +155,145 @@ func (j *JenkinsHome) GetPlugins() (elements *ElementsType, _ error) {
  ***************************** Internal Functions ******************************
  *******************************************************************************/
 
-// cleanUp remove plugins and groovies before install.
-func (j *JenkinsHome) cleanUp() {
-	pathsToCheck := []string{
+// checkInstallPaths verify Jenkins home plugins and groovies directories exist.
+func (j *JenkinsHome) checkInstallPaths() error {
+	for _, pathToCheck := range []string{
 		path.Join(j.homePath, jenkinsHomeGroovyPath),
 		path.Join(j.homePath, jenkinsHomePluginsPath),
+	} {
+		if info, err := os.Stat(pathToCheck); err != nil {
+			return fmt.Errorf("Unable to install. Invalid Jenkins home dir. %s", err)
+		} else if !info.IsDir() {
+			return fmt.Errorf("Unable to install. Invalid Jenkins home dir. %s is not a directory", pathToCheck)
+		}
 	}
+	return nil
+}
 
-	filesToCleanUp := make([]*regexp.Regexp, 2)
-	filesToCleanUp[0], _ = regexp.Compile(`^.*\.groovy$`)
-	filesToCleanUp[1], _ = regexp.Compile(`^.*\.[jh]pi$`)
-
-	for index, pathToCheck := range pathsToCheck {
-		if info, err := os.Stat(pathToCheck); os.IsNotExist(err) || !info.IsDir() {
-			if err != nil {
-				gotrace.Error("Unable to install. Invalid Jenkins home dir. %s", err)
-			} else {
-				gotrace.Error("Unable to install. Invalid Jenkins home dir. %s is not a directory", pathToCheck, err)
+// cleanUp register plugins (with states markers), groovies, casc files and files previously installed by features
+// to remove if they are not installed anymore.
+// Files installed by features are listed in the Jenkins home `.jplugins-files` file.
+func (j *JenkinsHome) cleanUp(transaction *installTransaction) error {
+	filesToCleanUp := make(map[string]*regexp.Regexp)
+	filesToCleanUp[jenkinsHomeGroovyPath], _ = regexp.Compile(`^.*\.groovy$`)
+	filesToCleanUp[jenkinsHomePluginsPath], _ = regexp.Compile(`^.*\.[jh]pi(\.(` + PluginDisabled + `|` + PluginPinned + `))?$`)
+	filesToCleanUp[jenkinsHomeCascPath], _ = regexp.Compile(`^.*\.ya?ml$`)
+
+	for dir, fileRE := range filesToCleanUp {
+		cleanupDir, _ := ioutil.ReadDir(path.Join(j.homePath, dir))
+		for _, element := range cleanupDir {
+			if file := path.Join(dir, element.Name()); !element.IsDir() && fileRE.MatchString(element.Name()) && !transaction.installed(file) {
+				transaction.remove(file)
 			}
-			return
 		}
+	}
 
-		cleanupDir, _ := ioutil.ReadDir(pathToCheck)
-		for _, element := range cleanupDir {
-			if fileName := element.Name(); filesToCleanUp[index].MatchString(fileName) {
-				if err := os.Remove(path.Join(pathToCheck, fileName)); err != nil {
-					gotrace.Error("Cleanup failure. %s", err)
-					os.Exit(1)
-				}
-			}
+	filesList := path.Join(j.homePath, jenkinsHomeFilesList)
+	data, err := ioutil.ReadFile(filesList)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to read '%s'. %s", filesList, err)
+	}
+	for _, dest := range strings.Split(string(data), "\n") {
+		if dest = strings.Trim(dest, " "); dest == "" || checkFileDest(dest) != nil || transaction.installed(dest) {
+			continue
 		}
+		transaction.remove(dest)
+	}
+	if !transaction.installed(jenkinsHomeFilesList) {
+		transaction.remove(jenkinsHomeFilesList)
 	}
+	return nil
 }
 
-// install plugins and groovies as defined by plugins list.
-func (j *JenkinsHome) install(elementsType *ElementsType, featureRepoPath string) error {
+// stageFilesList prepare the list of files installed by features in the Jenkins home.
+func (j *JenkinsHome) stageFilesList(files []string, transaction *installTransaction) error {
+	if len(files) == 0 {
+		return nil
+	}
+	sort.Strings(files)
+	return transaction.stageData(jenkinsHomeFilesList, []byte(strings.Join(files, "\n")+"\n"))
+}
+
+// stagePluginStates prepare the plugin states markers next to the plugin archive. (`<plugin>.hpi.disabled`)
+func (j *JenkinsHome) stagePluginStates(plugin *Plugin, archive string, transaction *installTransaction) error {
+	for _, state := range plugin.states {
+		if err := transaction.stageData(path.Join(jenkinsHomePluginsPath, archive+"."+state), []byte{}); err != nil {
+			return fmt.Errorf("Unable to set plugin '%s' as %s. %s", plugin.ExtensionName, state, err)
+		}
+		gotrace.Trace("Plugin '%s' set as %s.", plugin.ExtensionName, state)
+	}
+	return nil
+}
+
+// runInstall prepare the transaction with the prepare function, then swap files prepared with the installed ones.
+// Files not installed anymore are removed and files replaced or removed are saved in a snapshot.
+// If the snapshot cannot be saved, replaced files are kept in the transaction backup directory and an error is returned.
+func (j *JenkinsHome) runInstall(prepare func(transaction *installTransaction) error) error {
+	if err := j.checkInstallPaths(); err != nil {
+		return err
+	}
+
+	transaction, err := newInstallTransaction(j.homePath)
+	if err != nil {
+		return err
+	}
+	defer transaction.close()
+
+	if err = prepare(transaction); err != nil {
+		return err
+	}
+	if err = j.cleanUp(transaction); err != nil {
+		return err
+	}
+
+	updated, removed, err := transaction.commit()
+	if err != nil {
+		return err
+	}
+	gotrace.Info("Jenkins home updated: %d file(s) installed, %d file(s) removed.", updated, removed)
+
+	if j.cache != nil && j.cache.maxSize > 0 {
+		if _, _, err := j.cache.GC(); err != nil {
+			gotrace.Warning("%s", err)
+		}
+	}
+
+	if snapshot, err := j.saveSnapshot(transaction); err != nil {
+		transaction.keepBackup = true
+		return fmt.Errorf("Jenkins home updated, but the previous installation was not saved. %s. "+
+			"Replaced and removed files are kept in '%s'", err, transaction.backupPath)
+	} else if snapshot != "" {
+		gotrace.Info("Previous installation saved in snapshot '%s'. Use `jplugins rollback` to restore it.", snapshot)
+	}
+	return nil
+}
+
+// installedPlugin return the plugin archive name (.jpi or .hpi) if already installed with the expected sha256.
+func (j *JenkinsHome) installedPlugin(plugin *Plugin) (archive string, _ bool) {
+	if plugin.checkSumSha256 == "" {
+		return
+	}
+	for _, ext := range []string{".jpi", ".hpi"} {
+		archive = path.Base(plugin.ExtensionName) + ext
+		if sha, err := fileSha256(path.Join(j.homePath, jenkinsHomePluginsPath, archive)); err == nil && sha == plugin.checkSumSha256 {
+			return archive, true
+		}
+	}
+	return "", false
+}
+
+// install prepare plugins, groovies and files as defined by plugins list in the transaction staging directory.
+// Plugins already installed with the expected sha256 are kept. Others are downloaded in parallel. (see SetJobs)
+func (j *JenkinsHome) install(elementsType *ElementsType, featureRepoPath string, transaction *installTransaction) error {
 	iCountGroovy := 0
+	iCountFile := 0
 	iCountPlugin := 0
-	iCountError := 0
+	iCountKept := 0
+	filesInstalled := make([]string, 0, 5)
+	failures := make([]string, 0)
 	iCountObsolete := 0
 
 	elementsList := make([]string, elementsType.Length())
@@ -216,6 +320,12 @@ func (j *JenkinsHome) install(elementsType *ElementsType, featureRepoPath string
 	nameFormat := "- %-" + strconv.Itoa(iMaxName) + "s ... "
 	pluginVersionFormat := "%-" + strconv.Itoa(iMaxVersion) + "s"
 
+	// Plugins are downloaded first, in parallel. Results are reported below in the elements order.
+	downloads, err := j.prepareDownloads(elementsType, transaction)
+	if err != nil {
+		return err
+	}
+
 	iCount = 0
 	sort.Strings(elementsList)
 
@@ -237,19 +347,79 @@ func (j *JenkinsHome) install(elementsType *ElementsType, featureRepoPath string
 				continue
 			}
 
-			groovyObj := newGroovyStatusDetails(name, featureRepoPath)
+			sourcePath := featureRepoPath
+			if groovy.repoName != "" {
+				repo, err := elementsType.getFeaturesRepo(groovy.repoName)
+				if err != nil {
+					gotrace.Error("Installation issue. %s.", err)
+					failures = append(failures, displayName)
+					continue
+				}
+				sourcePath = repo.Path()
+			}
+
+			groovyObj := newGroovyStatusDetails(name, sourcePath)
+			groovyObj.repoName = groovy.repoName
 			groovyObj.newCommit = groovy.CommitID
 			if !gotrace.IsDebugMode() {
 				fmt.Printf(nameFormat, displayName)
 			}
-			if err := groovyObj.installIt(path.Join(j.homePath, jenkinsHomeGroovyPath)); err != nil {
-				gotrace.Error("Installation issue. %s. Ignored.", err)
-				iCountError++
+			stagingDir, err := transaction.stagingDir(jenkinsHomeGroovyPath)
+			if err == nil {
+				err = groovyObj.installIt(stagingDir)
+			}
+			if err != nil {
+				gotrace.Error("Installation issue. %s.", err)
+				failures = append(failures, displayName)
 			} else {
+				transaction.stage(path.Join(jenkinsHomeGroovyPath, path.Base(name)+".groovy"))
 				iCountGroovy++
 				iCount++
 				if !gotrace.IsDebugMode() {
-					fmt.Printf(" installed - %s\n", groovy.CommitID)
+					fmt.Printf(" prepared - %s\n", groovy.CommitID)
+				}
+			}
+
+		case cascType, fileType:
+			file := element.(*FeatureFile)
+			if file.CommitID == "" {
+				if !gotrace.IsDebugMode() {
+					fmt.Printf(nameFormat, displayName)
+					fmt.Print("obsolete - removed if found.")
+				}
+				iCountObsolete++
+				continue
+			}
+
+			sourcePath := featureRepoPath
+			if file.repoName != "" {
+				repo, err := elementsType.getFeaturesRepo(file.repoName)
+				if err != nil {
+					gotrace.Error("Installation issue. %s.", err)
+					failures = append(failures, displayName)
+					continue
+				}
+				sourcePath = repo.Path()
+			}
+
+			fileObj := newFileStatusDetails(file.fileType, name, file.Dest, sourcePath)
+			fileObj.repoName = file.repoName
+			fileObj.newCommit = file.CommitID
+			if !gotrace.IsDebugMode() {
+				fmt.Printf(nameFormat, displayName)
+			}
+			if err := fileObj.installIt(transaction.stagingPath); err != nil {
+				gotrace.Error("Installation issue. %s.", err)
+				failures = append(failures, displayName)
+			} else {
+				transaction.stage(file.Dest)
+				if file.fileType == fileType {
+					filesInstalled = append(filesInstalled, file.Dest)
+				}
+				iCountFile++
+				iCount++
+				if !gotrace.IsDebugMode() {
+					fmt.Printf(" prepared - %s => %s\n", file.CommitID, file.Dest)
 				}
 			}
 
@@ -264,33 +434,66 @@ func (j *JenkinsHome) install(elementsType *ElementsType, featureRepoPath string
 				continue
 			}
 
-			pluginObj := newPluginsStatusDetails()
-			pluginObj.setVersion(plugin.Version)
-			pluginObj.name = plugin.ExtensionName
-			pluginObj.newSha256Version = plugin.checkSumSha256
 			if !gotrace.IsDebugMode() {
 				fmt.Printf(nameFormat, displayName)
 			}
-			if err := pluginObj.installIt(path.Join(j.homePath, jenkinsHomePluginsPath)); err != nil {
-				gotrace.Error("Installation issue. %s. Ignored.", err)
-				iCountError++
+			states := ""
+			if len(plugin.states) > 0 {
+				states = " (" + strings.Join(plugin.states, ", ") + ")"
+			}
+
+			download := downloads[name]
+			if download.kept {
+				transaction.keep(path.Join(jenkinsHomePluginsPath, download.archive))
+				if err := j.stagePluginStates(plugin, download.archive, transaction); err != nil {
+					gotrace.Error("Installation issue. %s.", err)
+					failures = append(failures, displayName)
+					continue
+				}
+				iCountKept++
+				iCount++
+				if !gotrace.IsDebugMode() {
+					fmt.Printf(" kept - "+pluginVersionFormat+"%s\n", plugin.Version, states)
+				}
+				continue
+			}
+
+			err := download.err
+			if err == nil {
+				err = j.stagePluginStates(plugin, download.archive, transaction)
+			}
+			if err != nil {
+				gotrace.Error("Installation issue. %s.", err)
+				failures = append(failures, displayName)
 			} else {
+				transaction.stage(path.Join(jenkinsHomePluginsPath, download.archive))
 				iCountPlugin++
 				iCount++
 				if !gotrace.IsDebugMode() {
+					pluginObj := download.details
 					notVerified := ""
 					if !pluginObj.checkSumVerified {
 						notVerified = " not verified!"
 					}
-					fmt.Printf(" installed - "+pluginVersionFormat+" sha256:%s%s\n", plugin.Version, pluginObj.newSha256Version, notVerified)
+					action := "downloaded"
+					if pluginObj.fromCache {
+						action = "from cache"
+					}
+					fmt.Printf(" "+action+" - "+pluginVersionFormat+" sha256:%s%s%s\n", plugin.Version, pluginObj.newSha256Version, notVerified, states)
 				}
 			}
 		}
 	}
 
-	gotrace.Info("Total %d installed: %d plugins, %d groovies. %d obsoleted. %d error(s) found.\n", iCount, iCountPlugin, iCountGroovy, iCountObsolete, iCountError)
-	if iCountError > 0 {
-		return fmt.Errorf("%d errors detected", iCountError)
+	if err := j.stageFilesList(filesInstalled, transaction); err != nil {
+		gotrace.Error("%s", err)
+		failures = append(failures, jenkinsHomeFilesList)
+	}
+
+	gotrace.Info("Total %d prepared: %d plugins downloaded, %d plugins kept, %d groovies, %d files. %d obsoleted. %d error(s) found.\n",
+		iCount, iCountPlugin, iCountKept, iCountGroovy, iCountFile, iCountObsolete, len(failures))
+	if len(failures) > 0 {
+		return fmt.Errorf("%d errors detected (%s). Jenkins home not updated", len(failures), strings.Join(failures, ", "))
 	}
 
 	return nil
@@ -0,0 +1,138 @@
+package coremgt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/forj-oss/forjj-modules/trace"
+)
+
+// jenkinsPluginsAPI is the Jenkins REST API returning installed plugins with their dependencies.
+const jenkinsPluginsAPI = "/pluginManager/api/json?depth=1"
+
+// JenkinsRemote represents a running Jenkins where we identify plugins through the REST API
+type JenkinsRemote struct {
+	url   string
+	user  string
+	token string // API token (or password) of the user.
+}
+
+// jenkinsPluginsList is the pluginManager API response.
+type jenkinsPluginsList struct {
+	Plugins []jenkinsAPIPlugin `json:"plugins"`
+}
+
+type jenkinsAPIPlugin struct {
+	ShortName      string                 `json:"shortName"`
+	LongName       string                 `json:"longName"`
+	Version        string                 `json:"version"`
+	JenkinsVersion string                 `json:"requiredCoreVersion"`
+	Enabled        bool                   `json:"enabled"`
+	Pinned         bool                   `json:"pinned"`
+	Dependencies   []jenkinsAPIDependency `json:"dependencies"`
+}
+
+type jenkinsAPIDependency struct {
+	ShortName string `json:"shortName"`
+	Version   string `json:"version"`
+	Optional  bool   `json:"optional"`
+}
+
+// NewJenkinsRemote creates a new JenkinsRemote object
+func NewJenkinsRemote(jenkinsURL string) (ret *JenkinsRemote) {
+	ret = new(JenkinsRemote)
+	ret.url = strings.TrimSuffix(jenkinsURL, "/")
+	return ret
+}
+
+// SetAuth set the user and API token used to authenticate to Jenkins. An empty user means anonymous access.
+func (r *JenkinsRemote) SetAuth(user, token string) {
+	if r == nil {
+		return
+	}
+	r.user = user
+	r.token = token
+}
+
+// String return the Jenkins URL
+func (r *JenkinsRemote) String() string {
+	if r == nil {
+		return "nil"
+	}
+	return r.url
+}
+
+// GetPlugins read the list of plugins installed in Jenkins from its REST API and load them in a Plugins object,
+// as JenkinsHome.GetPlugins does.
+func (r *JenkinsRemote) GetPlugins() (elements *ElementsType, err error) {
+	if r == nil {
+		return
+	}
+	apiURL := r.url + jenkinsPluginsAPI
+	resp, err := httpAuthRequest("GET", apiURL, r.user, r.token)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read Jenkins plugins. %s", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case 200:
+	case 401, 403:
+		return nil, fmt.Errorf("Unable to read Jenkins plugins from '%s'. %s. Check the Jenkins user and API token", apiURL, resp.Status)
+	default:
+		return nil, fmt.Errorf("Unable to read Jenkins plugins from '%s'. %s", apiURL, resp.Status)
+	}
+
+	var list jenkinsPluginsList
+	if err = json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("Invalid Jenkins plugins list from '%s'. %s", apiURL, err)
+	}
+
+	elements = NewElementsType()
+	elements.NoRecursiveChain()
+
+	for _, apiPlugin := range list.Plugins {
+		if apiPlugin.ShortName == "" {
+			gotrace.Error("Plugin without name returned by '%s'. Ignored.", apiURL)
+			continue
+		}
+		if _, err = elements.AddElement(apiPlugin.asPlugin()); err != nil {
+			return nil, err
+		}
+	}
+	gotrace.Trace("%d plugin(s) read from '%s'.", len(list.Plugins), apiURL)
+	return
+}
+
+/************************************************************************
+ ***************** INTERNAL FUNCTIONS ***********************************
+ ************************************************************************/
+
+// asPlugin creates a Plugin from the API data, as read from a plugin manifest.
+// Dependencies are set with the manifest format. (`<name>:<version>[;resolution:=optional],...`)
+func (p jenkinsAPIPlugin) asPlugin() (plugin *Plugin) {
+	dependencies := make([]string, 0, len(p.Dependencies))
+	for _, dependency := range p.Dependencies {
+		dependencyString := dependency.ShortName + ":" + dependency.Version
+		if dependency.Optional {
+			dependencyString += ";resolution:=optional"
+		}
+		dependencies = append(dependencies, dependencyString)
+	}
+
+	plugin = newPluginFromManifest(map[string]string{
+		"Plugin-Version":      p.Version,
+		"Short-Name":          p.ShortName,
+		"Jenkins-Version":     p.JenkinsVersion,
+		"Long-Name":           p.LongName,
+		"Plugin-Dependencies": strings.Join(dependencies, ","),
+	})
+	if !p.Enabled {
+		plugin.addState(PluginDisabled)
+	}
+	if p.Pinned {
+		plugin.addState(PluginPinned)
+	}
+	return
+}
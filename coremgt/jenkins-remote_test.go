@@ -0,0 +1,92 @@
+package coremgt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const jenkinsRemotePluginsJSON = `{"plugins": [
+  {"shortName": "git", "longName": "Git plugin", "version": "3.9.1", "requiredCoreVersion": "1.625.3",
+   "enabled": true, "pinned": true,
+   "dependencies": [
+     {"shortName": "scm-api", "version": "2.2.7", "optional": false},
+     {"shortName": "credentials", "version": "2.1.14", "optional": true}]},
+  {"shortName": "scm-api", "longName": "SCM API Plugin", "version": "2.2.7", "requiredCoreVersion": "1.642.3",
+   "enabled": false, "pinned": false, "dependencies": []}
+]}`
+
+func newJenkinsRemoteServer(t *testing.T, user, token string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/pluginManager/api/json" || r.URL.Query().Get("depth") != "1" {
+			t.Errorf("Unexpected request '%s'", r.URL)
+			http.NotFound(w, r)
+			return
+		}
+		if reqUser, reqToken, ok := r.BasicAuth(); !ok || reqUser != user || reqToken != token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(jenkinsRemotePluginsJSON))
+	}))
+}
+
+func TestJenkinsRemoteGetPlugins(t *testing.T) {
+	server := newJenkinsRemoteServer(t, "admin", "api-token")
+	defer server.Close()
+
+	remote := NewJenkinsRemote(server.URL + "/")
+	remote.SetAuth("admin", "api-token")
+	elements, err := remote.GetPlugins()
+	if err != nil {
+		t.Fatalf("GetPlugins failed. %s", err)
+	}
+
+	plugins := elements.GetElements(pluginType)
+	if len(plugins) != 2 {
+		t.Fatalf("Expected 2 plugins, got %d", len(plugins))
+	}
+
+	git, ok := plugins["git"].(*Plugin)
+	if !ok {
+		t.Fatalf("Plugin 'git' not found")
+	}
+	if git.Version != "3.9.1" || git.JenkinsVersion != "1.625.3" || git.LongName != "Git plugin" {
+		t.Errorf("Unexpected git plugin data: version '%s', Jenkins version '%s', long name '%s'",
+			git.Version, git.JenkinsVersion, git.LongName)
+	}
+	if expected := "scm-api:2.2.7,credentials:2.1.14;resolution:=optional"; git.Dependencies != expected {
+		t.Errorf("Expected git dependencies '%s', got '%s'", expected, git.Dependencies)
+	}
+	if !git.hasState(PluginPinned) || git.hasState(PluginDisabled) {
+		t.Errorf("Expected git plugin pinned and enabled, got states '%v'", git.states)
+	}
+
+	scmAPI, ok := plugins["scm-api"].(*Plugin)
+	if !ok {
+		t.Fatalf("Plugin 'scm-api' not found")
+	}
+	if scmAPI.Dependencies != "" {
+		t.Errorf("Expected no scm-api dependencies, got '%s'", scmAPI.Dependencies)
+	}
+	if !scmAPI.hasState(PluginDisabled) || scmAPI.hasState(PluginPinned) {
+		t.Errorf("Expected scm-api plugin disabled and not pinned, got states '%v'", scmAPI.states)
+	}
+}
+
+func TestJenkinsRemoteUnauthorized(t *testing.T) {
+	server := newJenkinsRemoteServer(t, "admin", "api-token")
+	defer server.Close()
+
+	remote := NewJenkinsRemote(server.URL)
+	remote.SetAuth("admin", "wrong-token")
+	elements, err := remote.GetPlugins()
+	if err == nil {
+		t.Fatalf("GetPlugins must fail with a wrong token. Got %d plugin(s)", len(elements.GetElements(pluginType)))
+	}
+	if !strings.Contains(err.Error(), "401") || !strings.Contains(err.Error(), "Check the Jenkins user and API token") {
+		t.Errorf("Unexpected error message: %s", err)
+	}
+}
@@ -0,0 +1,97 @@
+package coremgt
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"path"
+
+	"github.com/forj-oss/forjj-modules/trace"
+)
+
+// jenkinsWarPluginsPaths are the war directories of plugins installed by Jenkins at first startup.
+var jenkinsWarPluginsPaths = []string{"WEB-INF/plugins/", "WEB-INF/detached-plugins/"}
+
+// ReadWarPlugins read plugins bundled (WEB-INF/plugins) and detached (WEB-INF/detached-plugins) in a Jenkins war,
+// from their manifest. Nothing is extracted on disk.
+// If a plugin is found in both directories, the highest version is kept.
+func ReadWarPlugins(warFile string) (elements *ElementsType, err error) {
+	war, err := zip.OpenReader(warFile)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open '%s'. %s", warFile, err)
+	}
+	defer war.Close()
+
+	elements = NewElementsType()
+	elements.NoRecursiveChain()
+
+	for _, zipFile := range war.File {
+		if !isWarPlugin(zipFile.Name) {
+			continue
+		}
+		data, err := readZipEntry(zipFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read '%s' from '%s'. %s", zipFile.Name, warFile, err)
+		}
+		plugin, err := readPluginArchiveManifest(data)
+		if err != nil {
+			gotrace.Error("Unable to read the manifest of '%s' from '%s'. %s. Ignored", zipFile.Name, warFile, err)
+			continue
+		}
+		if plugin.Name() == "" {
+			gotrace.Error("'%s' from '%s' has no plugin name. Ignored", zipFile.Name, warFile)
+			continue
+		}
+
+		if existing, found := elements.GetElement(pluginType, plugin.Name()).(*Plugin); found {
+			if highestVersion(existing.Version, plugin.Version) == existing.Version {
+				continue
+			}
+		}
+		gotrace.Trace("%s %s found in '%s'.", plugin.Name(), plugin.Version, zipFile.Name)
+		if _, err = elements.AddElement(plugin); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+/************************************************************************
+ ***************** INTERNAL FUNCTIONS ***********************************
+ ************************************************************************/
+
+// isWarPlugin return true if the war file is a plugin archive installed by Jenkins.
+func isWarPlugin(file string) bool {
+	if ext := path.Ext(file); ext != ".hpi" && ext != ".jpi" {
+		return false
+	}
+	for _, pluginsPath := range jenkinsWarPluginsPaths {
+		if path.Dir(file)+"/" == pluginsPath {
+			return true
+		}
+	}
+	return false
+}
+
+// readPluginArchiveManifest read the manifest of a plugin archive loaded in memory.
+func readPluginArchiveManifest(data []byte) (_ *Plugin, err error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return
+	}
+	for _, zipFile := range archive.File {
+		if zipFile.Name != pluginManifestFile {
+			continue
+		}
+		var manifest []byte
+		if manifest, err = readZipEntry(zipFile); err != nil {
+			return
+		}
+		attributes, err := parseManifest(manifest)
+		if err != nil {
+			return nil, err
+		}
+		return newPluginFromManifest(attributes), nil
+	}
+	return nil, fmt.Errorf("'%s' not found", pluginManifestFile)
+}
@@ -0,0 +1,335 @@
+package coremgt
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/forj-oss/forjj-modules/trace"
+)
+
+// LockMerge executes a three-way merge of lock files elements (base, ours and theirs)
+//
+// Rules applied on each element:
+// - Same version on both sides, or only one side changed: take it.
+// - Both sides changed a plugin version: take the highest version.
+// - Both sides changed a groovy commit, or one side removed what the other changed: report a conflict.
+//
+// The Jenkins core (`jenkins:<version>`) follows the plugin rules.
+// Plugin states (disabled, pinned) are merged as groovy commits: changed on both sides differently is a conflict.
+// Sources hashes (`lst:`, `desc:`) are kept only if both sides recorded the same.
+//
+// Conflicting records are not merged. WriteLock writes them between GIT conflict markers.
+type LockMerge struct {
+	base            *ElementsType
+	ours            *ElementsType
+	theirs          *ElementsType
+	merged          *ElementsType
+	conflicts       []string
+	conflictRecords []lockConflict
+}
+
+// lockConflict is a record in conflict, as written in our and their lock files. Empty if removed.
+type lockConflict struct {
+	ours   string
+	theirs string
+}
+
+// NewLockMerge creates a LockMerge object
+func NewLockMerge(base, ours, theirs *ElementsType) (ret *LockMerge) {
+	ret = new(LockMerge)
+	ret.base = base
+	ret.ours = ours
+	ret.theirs = theirs
+	ret.conflicts = make([]string, 0, 4)
+	return
+}
+
+// Merge build the merged elements list and return the list of true conflicts found.
+// In case of conflict, the element is not in the merged list.
+func (m *LockMerge) Merge() (merged *ElementsType, conflicts []string) {
+	if m == nil {
+		return
+	}
+	m.merged = NewElementsType()
+	m.merged.AddSupport(pluginType, groovyType, cascType, fileType)
+	m.merged.NoRecursiveChain()
+	for _, elementType := range []string{groovyType, cascType, fileType} {
+		m.merged.AddSupportContext(elementType, "noMoreContext", "true")
+	}
+
+	for _, elementType := range []string{pluginType, groovyType, cascType, fileType} {
+		for _, name := range m.elementNames(elementType) {
+			baseVersion := m.version(m.base, elementType, name)
+			ourVersion := m.version(m.ours, elementType, name)
+			theirVersion := m.version(m.theirs, elementType, name)
+
+			version := ourVersion
+			conflict := false
+			switch {
+			case ourVersion == theirVersion:
+			case ourVersion == baseVersion:
+				version = theirVersion
+			case theirVersion == baseVersion:
+			case ourVersion == "" || theirVersion == "":
+				m.addConflict("%s:%s removed on one side and changed on the other (base: '%s', ours: '%s', theirs: '%s')",
+					elementType, name, baseVersion, ourVersion, theirVersion)
+				conflict = true
+			case elementType == pluginType:
+				version = highestVersion(ourVersion, theirVersion)
+				gotrace.Trace("%s:%s changed on both sides. %s selected between '%s' and '%s'", elementType, name, version, ourVersion, theirVersion)
+			default:
+				m.addConflict("%s:%s changed on both sides (base: '%s', ours: '%s', theirs: '%s')",
+					elementType, name, baseVersion, ourVersion, theirVersion)
+				conflict = true
+			}
+
+			states, statesMerged := m.mergeStates(elementType, name)
+			if conflict || !statesMerged {
+				m.conflictRecords = append(m.conflictRecords, lockConflict{
+					ours:   m.lockRecord(m.ours, elementType, name),
+					theirs: m.lockRecord(m.theirs, elementType, name),
+				})
+				continue
+			}
+			if version == "" {
+				continue
+			}
+			fields := []string{elementType, name, version}
+			if file := m.file(elementType, name, version); file != nil {
+				fields = file.lockFields()
+			} else if repoName := m.repoName(elementType, name); repoName != "" {
+				fields = append(fields, repoName)
+			} else if states != "" {
+				fields = append(fields, states)
+			}
+			if _, err := m.merged.Add(fields...); err != nil {
+				m.addConflict("%s:%s cannot be merged. %s", elementType, name, err)
+			}
+		}
+	}
+
+	m.merged.core = m.mergeCore()
+	m.merged.sources = m.mergeSources()
+
+	// Keep named features repositories. Our URL is kept if both sides declare it.
+	for _, elements := range []*ElementsType{m.base, m.theirs, m.ours} {
+		for name, repoURL := range elements.featuresRepos.urls {
+			m.merged.featuresRepos.urls[name] = repoURL
+		}
+	}
+
+	return m.merged, m.conflicts
+}
+
+// WriteLock save the merged lock file. Conflicts are added at the end of the file, as comments, with
+// conflicting records between GIT conflict markers. So, they cannot be committed unnoticed.
+func (m *LockMerge) WriteLock(file string) (err error) {
+	if m == nil || m.merged == nil {
+		return
+	}
+	if err = m.merged.WriteLock(file); err != nil || len(m.conflicts) == 0 {
+		return
+	}
+
+	fd, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("Unable to write '%s'. %s", file, err)
+	}
+	defer fd.Close()
+
+	for _, conflict := range m.conflicts {
+		fmt.Fprintf(fd, "# CONFLICT: %s\n", conflict)
+	}
+	for _, records := range m.conflictRecords {
+		fmt.Fprintln(fd, "<<<<<<< ours")
+		if records.ours != "" {
+			fmt.Fprintln(fd, records.ours)
+		}
+		fmt.Fprintln(fd, "=======")
+		if records.theirs != "" {
+			fmt.Fprintln(fd, records.theirs)
+		}
+		fmt.Fprintln(fd, ">>>>>>> theirs")
+	}
+	return
+}
+
+// CheckDependencies verify that each merged plugin has its dependencies in the merged list
+// at the minimum version required by the updates repository.
+func (m *LockMerge) CheckDependencies(ref *Repository) (conflicts []string) {
+	if m == nil || m.merged == nil || ref == nil {
+		return
+	}
+	plugins := m.merged.GetElements(pluginType)
+
+	for _, name := range sortedElementNames(plugins) {
+		plugin := plugins[name].(*Plugin)
+		refPlugin, found := ref.Get(name, plugin.Version)
+		if !found {
+			gotrace.Warning("Plugin '%s' %s not found in the public repository. Dependencies not verified.", name, plugin.Version)
+			continue
+		}
+		if err := m.merged.core.CheckRequiredCore(name, plugin.Version, refPlugin.JenkinsVersion); err != nil {
+			m.addConflict("%s", err)
+		}
+		for _, dep := range refPlugin.Dependencies {
+			if dep.Optional {
+				continue
+			}
+			depElement, found := plugins[dep.Name]
+			if !found {
+				m.addConflict("plugin:%s:%s requires plugin:%s:%s which is missing from the merged lock", name, plugin.Version, dep.Name, dep.Version)
+				continue
+			}
+			if highestVersion(depElement.(*Plugin).Version, dep.Version) != depElement.(*Plugin).Version {
+				m.addConflict("plugin:%s:%s requires plugin:%s:%s, but merged version is %s", name, plugin.Version, dep.Name, dep.Version, depElement.(*Plugin).Version)
+			}
+		}
+	}
+	return m.conflicts
+}
+
+/************************************************************************
+ ***************** INTERNAL FUNCTIONS ***********************************
+ ************************************************************************/
+
+func (m *LockMerge) addConflict(format string, args ...interface{}) {
+	m.conflicts = append(m.conflicts, fmt.Sprintf(format, args...))
+}
+
+// elementNames return the sorted list of element names found in any merge sides.
+func (m *LockMerge) elementNames(elementType string) []string {
+	names := make(Elements)
+	for _, elements := range []*ElementsType{m.base, m.ours, m.theirs} {
+		for name, element := range elements.GetElements(elementType) {
+			names[name] = element
+		}
+	}
+	return sortedElementNames(names)
+}
+
+// mergeCore select the Jenkins core version between merge sides. nil in case of conflict.
+func (m *LockMerge) mergeCore() *JenkinsCore {
+	coreVersion := func(elements *ElementsType) string {
+		if core := elements.JenkinsCore(); core != nil {
+			return core.Version
+		}
+		return ""
+	}
+	baseVersion := coreVersion(m.base)
+	ourVersion := coreVersion(m.ours)
+	theirVersion := coreVersion(m.theirs)
+
+	switch {
+	case ourVersion == theirVersion, theirVersion == baseVersion:
+		return m.ours.JenkinsCore()
+	case ourVersion == baseVersion:
+		return m.theirs.JenkinsCore()
+	case ourVersion == "" || theirVersion == "":
+		m.addConflict("%s removed on one side and changed on the other (base: '%s', ours: '%s', theirs: '%s')",
+			jenkinsType, baseVersion, ourVersion, theirVersion)
+		m.conflictRecords = append(m.conflictRecords, lockConflict{
+			ours:   strings.Join(m.ours.JenkinsCore().lockFields(), ":"),
+			theirs: strings.Join(m.theirs.JenkinsCore().lockFields(), ":"),
+		})
+		return nil
+	}
+	if highestVersion(ourVersion, theirVersion) == theirVersion {
+		return m.theirs.JenkinsCore()
+	}
+	return m.ours.JenkinsCore()
+}
+
+// mergeStates select the plugin states (`disabled,pinned`) between merge sides. Empty if not a plugin.
+// merged is false if states changed on both sides.
+func (m *LockMerge) mergeStates(elementType, name string) (states string, merged bool) {
+	if elementType != pluginType {
+		return "", true
+	}
+	sideStates := func(elements *ElementsType) string {
+		if plugin, ok := elements.GetElement(pluginType, name).(*Plugin); ok {
+			return plugin.StatesString()
+		}
+		return ""
+	}
+	baseStates := sideStates(m.base)
+	ourStates := sideStates(m.ours)
+	theirStates := sideStates(m.theirs)
+
+	switch {
+	case ourStates == theirStates, theirStates == baseStates:
+		return ourStates, true
+	case ourStates == baseStates:
+		return theirStates, true
+	}
+	m.addConflict("%s:%s states changed on both sides (base: '%s', ours: '%s', theirs: '%s')",
+		pluginType, name, baseStates, ourStates, theirStates)
+	return
+}
+
+// mergeSources keep the sources hashes if both sides recorded the same. Otherwise, none are kept,
+// as the merged lock file was not built from those sources.
+func (m *LockMerge) mergeSources() *LockSources {
+	if m.ours.sources.Equal(m.theirs.sources) {
+		return m.ours.sources
+	}
+	gotrace.Warning("Features file or features descriptors differ between merged lock files. Sources hashes are not kept. " +
+		"Please re-lock the merged lock file with 'jplugins init lockfile'.")
+	return NewLockSources()
+}
+
+// version return the version string of an element or "" if not found.
+func (m *LockMerge) version(elements *ElementsType, elementType, name string) string {
+	if element := elements.GetElement(elementType, name); element != nil {
+		return elementVersionString(element)
+	}
+	return ""
+}
+
+// lockRecord return the lock file record of an element from a merge side. Empty if not found.
+func (m *LockMerge) lockRecord(elements *ElementsType, elementType, name string) string {
+	if element := elements.GetElement(elementType, name); element != nil {
+		return strings.Join(lockFields(elementType, name, element), ":")
+	}
+	return ""
+}
+
+// repoName return the features repository name of a groovy, from any merge sides.
+func (m *LockMerge) repoName(elementType, name string) string {
+	for _, elements := range []*ElementsType{m.ours, m.theirs, m.base} {
+		if groovy, ok := elements.GetElement(elementType, name).(*Groovy); ok && groovy.repoName != "" {
+			return groovy.repoName
+		}
+	}
+	return ""
+}
+
+// file return the feature file element at the version given, from any merge sides. nil if not a file.
+func (m *LockMerge) file(elementType, name, version string) *FeatureFile {
+	for _, elements := range []*ElementsType{m.ours, m.theirs, m.base} {
+		if file, ok := elements.GetElement(elementType, name).(*FeatureFile); ok && file.CommitID == version {
+			return file
+		}
+	}
+	return nil
+}
+
+// highestVersion return the highest version between 2 version strings.
+// If versions cannot be compared, the first one is returned.
+func highestVersion(version1, version2 string) string {
+	if compareElementVersions(pluginType, version1, version2) == diffUpgraded {
+		return version2
+	}
+	return version1
+}
+
+func sortedElementNames(elements Elements) (names []string) {
+	names = make([]string, 0, len(elements))
+	for name := range elements {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
@@ -0,0 +1,250 @@
+package coremgt
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+
+	"jplugins/simplefile"
+
+	"github.com/forj-oss/forjj-modules/trace"
+)
+
+const (
+	// LstSource is the lock file record type for the features file (jplugins.lst) hash
+	LstSource = "lst"
+	// DescSource is the lock file record type for a feature descriptor (.desc) hash
+	DescSource = "desc"
+)
+
+// LockSources stores the content hash (sha256) of files read to build a lock file.
+//
+// Those are recorded in the lock file as `lst:<file>:<sha256>` and `desc:[<repo>/]<feature>/<feature>.desc:<sha256>[:<repo>[:<ref>]]`
+// lst files are relative to the lock file path. desc files are relative to the features repository path.
+// The desc reference is set when the feature is pinned. The file is then verified at this reference.
+type LockSources struct {
+	hashes map[string]map[string]lockSource
+}
+
+type lockSource struct {
+	hash     string
+	repoName string
+	ref      string
+}
+
+// NewLockSources creates a LockSources object
+func NewLockSources() (ret *LockSources) {
+	ret = new(LockSources)
+	ret.hashes = make(map[string]map[string]lockSource)
+	return
+}
+
+// AddFile compute the file hash and record it with the source type and name given.
+// repoName is the features repository name of a desc file. Empty for the default repository.
+func (s *LockSources) AddFile(sourceType, name, repoName, file string) (err error) {
+	if s == nil {
+		return
+	}
+	var hash string
+	if hash, err = fileSha256(file); err != nil {
+		return
+	}
+	s.Set(sourceType, name, repoName, "", hash)
+	return
+}
+
+// AddData compute the hash of data read from a source and record it.
+// ref is the branch, tag or commit ID the data was read from. Empty if read from the working tree.
+func (s *LockSources) AddData(sourceType, name, repoName, ref string, data []byte) {
+	if s == nil {
+		return
+	}
+	s.Set(sourceType, name, repoName, ref, dataSha256(data))
+}
+
+// Set record a source hash.
+func (s *LockSources) Set(sourceType, name, repoName, ref, hash string) {
+	if s == nil {
+		return
+	}
+	hashes, found := s.hashes[sourceType]
+	if !found {
+		hashes = make(map[string]lockSource)
+		s.hashes[sourceType] = hashes
+	}
+	hashes[name] = lockSource{hash: hash, repoName: repoName, ref: ref}
+}
+
+// Length return the number of sources recorded.
+func (s *LockSources) Length() (total int) {
+	if s == nil {
+		return
+	}
+	for _, hashes := range s.hashes {
+		total += len(hashes)
+	}
+	return
+}
+
+// Read load sources hashes recorded in a lock file. Other lock records are ignored.
+func (s *LockSources) Read(lockFile string) (err error) {
+	if s == nil {
+		return
+	}
+	data := simplefile.NewSimpleFile(lockFile, 3)
+
+	err = data.Read(":", func(fields []string) (_ error) {
+		s.setFromFields(fields)
+		return
+	})
+	return
+}
+
+// Equal is true if both sources lists record the same hashes.
+func (s *LockSources) Equal(other *LockSources) bool {
+	if s.Length() != other.Length() {
+		return false
+	}
+	if s == nil || other == nil {
+		return true
+	}
+	for sourceType, hashes := range s.hashes {
+		for name, source := range hashes {
+			if otherSource, found := other.hashes[sourceType][name]; !found || otherSource != source {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Check compare recorded hashes with files found in lstPath (lst) and featuresRepoPath (desc).
+// Named features repositories are expected next to featuresRepoPath.
+// It returns the list of changed or removed sources. Sources which cannot be verified, because
+// the base path do not exist, are reported as warning only.
+func (s *LockSources) Check(lstPath, featuresRepoPath string) (changes []string) {
+	if s == nil {
+		return
+	}
+	changes = make([]string, 0, 2)
+	basePaths := map[string]string{
+		LstSource:  lstPath,
+		DescSource: featuresRepoPath,
+	}
+
+	for _, sourceType := range []string{LstSource, DescSource} {
+		hashes := s.hashes[sourceType]
+		names := make([]string, 0, len(hashes))
+		for name := range hashes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			source := hashes[name]
+			basePath := basePaths[sourceType]
+			if source.repoName != "" {
+				basePath = namedFeaturesRepoPath(source.repoName)
+			}
+			file := path.Join(basePath, relativeName(source.repoName, name))
+			hash, err := source.currentHash(basePath, relativeName(source.repoName, name))
+			if err != nil {
+				if info, errPath := os.Stat(basePath); errPath != nil || !info.IsDir() {
+					gotrace.Warning("Unable to verify '%s'. %s", file, err)
+					continue
+				}
+				changes = append(changes, fmt.Sprintf("'%s' was removed since locked", file))
+				continue
+			}
+			if hash != source.hash {
+				if source.ref != "" {
+					file += " (at '" + source.ref + "')"
+				}
+				changes = append(changes, fmt.Sprintf("'%s' has changed since locked", file))
+			}
+		}
+	}
+	return
+}
+
+/************************************************************************
+ ***************** INTERNAL FUNCTIONS ***********************************
+ ************************************************************************/
+
+// setFromFields record a source from lock file fields. (`lst|desc:<name>:<sha256>[:<repo>[:<ref>]]`)
+// It returns false if fields are not a source record.
+func (s *LockSources) setFromFields(fields []string) (_ bool) {
+	if len(fields) < 3 || (fields[0] != LstSource && fields[0] != DescSource) {
+		return
+	}
+	repoName := ""
+	if len(fields) >= 4 {
+		repoName = fields[3]
+	}
+	ref := ""
+	if len(fields) >= 5 {
+		ref = fields[4]
+	}
+	s.Set(fields[0], fields[1], repoName, ref, fields[2])
+	return true
+}
+
+// addToLockFile add sources records to the lock file data. They are written at the top of the lock file.
+func (s *LockSources) addToLockFile(lockFile *simplefile.SimpleFile) {
+	if s == nil {
+		return
+	}
+	for sourceType, hashes := range s.hashes {
+		for name, source := range hashes {
+			fields := []string{sourceType, name, source.hash}
+			if source.repoName != "" || source.ref != "" {
+				fields = append(fields, source.repoName)
+			}
+			if source.ref != "" {
+				fields = append(fields, source.ref)
+			}
+			lockFile.AddWithKeyString("0-"+sourceType+"-"+name, fields...)
+		}
+	}
+}
+
+// currentHash return the current hash of the source file. A pinned source is read at its reference.
+func (s lockSource) currentHash(basePath, file string) (_ string, err error) {
+	if s.ref == "" {
+		return fileSha256(path.Join(basePath, file))
+	}
+	var commit, data string
+	if commit, err = gitResolveRef(basePath, s.ref); err != nil {
+		return
+	}
+	if data, err = gitShowFile(basePath, commit, file); err != nil {
+		return
+	}
+	return dataSha256([]byte(data)), nil
+}
+
+// dataSha256 return the base64 sha256 of the data given.
+func dataSha256(data []byte) string {
+	hash := sha256.Sum256(data)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// fileSha256 return the base64 sha256 of the file given.
+func fileSha256(file string) (_ string, err error) {
+	fd, err := os.Open(file)
+	if err != nil {
+		return "", fmt.Errorf("Unable to read '%s'. %s", file, err)
+	}
+	defer fd.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, bufio.NewReader(fd)); err != nil {
+		return "", fmt.Errorf("Unable to generate sha256 data. %s", err)
+	}
+	return base64.StdEncoding.EncodeToString(hash.Sum(nil)), nil
+}
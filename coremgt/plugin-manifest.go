@@ -0,0 +1,127 @@
+package coremgt
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+const pluginManifestFile = "META-INF/MANIFEST.MF"
+
+// readPluginManifest read the plugin MANIFEST.MF from the plugin exploded directory if it exists,
+// or directly from the plugin archive (.hpi/.jpi). Nothing is extracted on disk.
+func readPluginManifest(archiveFile, explodedPath string) (_ *Plugin, err error) {
+	var data []byte
+
+	explodedManifest := path.Join(explodedPath, pluginManifestFile)
+	if data, err = ioutil.ReadFile(explodedManifest); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("Unable to read file '%s'. %s", explodedManifest, err)
+		}
+		if data, err = readZipFile(archiveFile, pluginManifestFile); err != nil {
+			return
+		}
+	}
+
+	attributes, err := parseManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the manifest of '%s'. %s", archiveFile, err)
+	}
+	return newPluginFromManifest(attributes), nil
+}
+
+// parseManifest return the main section attributes of a java manifest.
+//
+// Lines are `<name>: <value>`. A line starting with a space continues the previous value.
+// The main section ends at the first empty line.
+func parseManifest(data []byte) (attributes map[string]string, _ error) {
+	attributes = make(map[string]string)
+
+	// Remove DOS format if exist
+	content := strings.Replace(string(data), "\r\n", "\n", -1)
+	content = strings.Replace(content, "\r", "\n", -1)
+
+	lastName := ""
+	lineNumber := 0
+	fileScan := bufio.NewScanner(strings.NewReader(content))
+	for fileScan.Scan() {
+		line := fileScan.Text()
+		lineNumber++
+		if line == "" {
+			break
+		}
+		if line[0] == ' ' {
+			if lastName == "" {
+				return nil, fmt.Errorf("Line %d: continuation line without attribute", lineNumber)
+			}
+			attributes[lastName] += line[1:]
+			continue
+		}
+
+		index := strings.Index(line, ":")
+		if index <= 0 {
+			return nil, fmt.Errorf("Line %d: invalid attribute '%s'. Expect '<name>: <value>'", lineNumber, line)
+		}
+		lastName = line[:index]
+		attributes[lastName] = strings.TrimPrefix(line[index+1:], " ")
+	}
+	return attributes, fileScan.Err()
+}
+
+// newPluginFromManifest creates a Plugin from manifest attributes.
+func newPluginFromManifest(attributes map[string]string) (plugin *Plugin) {
+	plugin = NewPlugin()
+	plugin.Version = attributes["Plugin-Version"]
+	plugin.ExtensionName = attributes["Extension-Name"]
+	plugin.ShortName = attributes["Short-Name"]
+	plugin.JenkinsVersion = attributes["Jenkins-Version"]
+	plugin.LongName = attributes["Long-Name"]
+	plugin.Dependencies = attributes["Plugin-Dependencies"]
+	plugin.Description = attributes["Specification-Title"]
+	if plugin.ExtensionName == "" {
+		// Some plugins do not define Extension-Name.
+		plugin.ExtensionName = plugin.ShortName
+	}
+	return
+}
+
+// readZipFile return the content of a file stored in a zip archive.
+func readZipFile(archiveFile, file string) (_ []byte, err error) {
+	archive, err := zip.OpenReader(archiveFile)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open '%s'. %s", archiveFile, err)
+	}
+	defer archive.Close()
+
+	for _, zipFile := range archive.File {
+		if zipFile.Name != file {
+			continue
+		}
+		data, err := readZipEntry(zipFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read '%s' from '%s'. %s", file, archiveFile, err)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("'%s' not found in '%s'", file, archiveFile)
+}
+
+// readZipEntry return the content of a zip archive entry.
+func readZipEntry(zipFile *zip.File) (_ []byte, err error) {
+	fd, err := zipFile.Open()
+	if err != nil {
+		return
+	}
+	defer fd.Close()
+
+	var data bytes.Buffer
+	if _, err = data.ReadFrom(fd); err != nil {
+		return
+	}
+	return data.Bytes(), nil
+}
@@ -0,0 +1,89 @@
+package coremgt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected map[string]string
+		fails    bool
+	}{
+		{
+			name: "simple",
+			data: "Manifest-Version: 1.0\nShort-Name: git\nPlugin-Version: 3.9.1\n",
+			expected: map[string]string{
+				"Manifest-Version": "1.0",
+				"Short-Name":       "git",
+				"Plugin-Version":   "3.9.1",
+			},
+		},
+		{
+			name: "CRLF line endings",
+			data: "Manifest-Version: 1.0\r\nShort-Name: git\r\nPlugin-Version: 3.9.1\r\n",
+			expected: map[string]string{
+				"Manifest-Version": "1.0",
+				"Short-Name":       "git",
+				"Plugin-Version":   "3.9.1",
+			},
+		},
+		{
+			name: "wrapped Plugin-Dependencies",
+			data: "Short-Name: git\r\n" +
+				"Plugin-Dependencies: workflow-scm-step:2.4,credentials:2.1.14,ssh-cre\r\n" +
+				" dentials:1.13,scm-api:2.2.7;resolution:=optional\r\n" +
+				"Plugin-Version: 3.9.1\r\n",
+			expected: map[string]string{
+				"Short-Name":          "git",
+				"Plugin-Dependencies": "workflow-scm-step:2.4,credentials:2.1.14,ssh-credentials:1.13,scm-api:2.2.7;resolution:=optional",
+				"Plugin-Version":      "3.9.1",
+			},
+		},
+		{
+			name: "colons in values",
+			data: "Url: https://wiki.jenkins.io/display/JENKINS/Git+Plugin\nPlugin-Dependencies: scm-api:2.2.7\n",
+			expected: map[string]string{
+				"Url":                 "https://wiki.jenkins.io/display/JENKINS/Git+Plugin",
+				"Plugin-Dependencies": "scm-api:2.2.7",
+			},
+		},
+		{
+			name: "stop at the first empty line",
+			data: "Short-Name: git\nPlugin-Version: 3.9.1\n\nName: hudson/plugins/git/\nImplementation-Version: 3.9.1\n",
+			expected: map[string]string{
+				"Short-Name":     "git",
+				"Plugin-Version": "3.9.1",
+			},
+		},
+		{
+			name:  "continuation line without attribute",
+			data:  " dentials:1.13\nShort-Name: git\n",
+			fails: true,
+		},
+		{
+			name:  "invalid attribute",
+			data:  "Short-Name git\n",
+			fails: true,
+		},
+	}
+
+	for _, test := range tests {
+		attributes, err := parseManifest([]byte(test.data))
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: parseManifest must fail", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: parseManifest failed. %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(attributes, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, attributes)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package coremgt
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 
 	goversion "github.com/hashicorp/go-version"
@@ -12,6 +13,11 @@ import (
 
 const (
 	pluginType = "plugin"
+
+	// PluginDisabled is the plugin state installed as a `<plugin>.hpi.disabled` marker in Jenkins home.
+	PluginDisabled = "disabled"
+	// PluginPinned is the plugin state installed as a `<plugin>.hpi.pinned` marker in Jenkins home.
+	PluginPinned = "pinned"
 )
 
 // Plugin describe details on Plugin element.
@@ -24,7 +30,8 @@ type Plugin struct {
 	LongName       string `yaml:"Long-Name"`
 	Dependencies   string `yaml:"Plugin-Dependencies"`
 	Description    string `yaml:"Specification-Title"`
-	checkSumSha256 string 
+	checkSumSha256 string
+	states         []string // Plugin states (disabled, pinned) declared as 4th field.
 	rules          map[string]goversion.Constraints
 	fixed          bool     // true if a constraint force a version
 	parents        Elements // List of parent Elements dependencies
@@ -137,9 +144,56 @@ func (p *Plugin) setFrom(fields ...string) (err error) {
 	if fieldsSize >= 3 {
 		p.Version = fields[2]
 	}
+	if fieldsSize >= 4 {
+		var states []string
+		if states, err = parsePluginStates(fields[3]); err != nil {
+			return
+		}
+		for _, state := range states {
+			p.addState(state)
+		}
+	}
 	return
 }
 
+// States return the sorted list of plugin states. (disabled, pinned)
+func (p *Plugin) States() []string {
+	if p == nil {
+		return nil
+	}
+	return p.states
+}
+
+// StatesString return plugin states as a comma separated list, as written in features and lock files.
+func (p *Plugin) StatesString() string {
+	if p == nil {
+		return ""
+	}
+	return strings.Join(p.states, ",")
+}
+
+// hasState return true if the plugin has the state given.
+func (p *Plugin) hasState(state string) (_ bool) {
+	if p == nil {
+		return
+	}
+	for _, pluginState := range p.states {
+		if pluginState == state {
+			return true
+		}
+	}
+	return
+}
+
+// addState add a state to the plugin, if not already set.
+func (p *Plugin) addState(state string) {
+	if p == nil || p.hasState(state) {
+		return
+	}
+	p.states = append(p.states, state)
+	sort.Strings(p.states)
+}
+
 // CompleteFromContext update the plugin information from repo DB if found
 func (p *Plugin) CompleteFromContext(context *ElementsType) (err error) {
 	if p == nil || context == nil || context.ref == nil {
@@ -187,7 +241,7 @@ func (p *Plugin) ChainElement(context *ElementsType) (ret *ElementsType, _ error
 
 	ret = NewElementsType()
 	ret.AddSupport(pluginType)
-	ret.noRecursiveChain()
+	ret.NoRecursiveChain()
 	ret.SetRepository(context.ref)
 
 	for _, dep := range refPlugin.Dependencies {
@@ -213,6 +267,12 @@ func (p *Plugin) Merge(context *ElementsType, element Element, policy int) (upda
 	if p == nil {
 		return
 	}
+	// Plugin states are cumulative, whatever the version kept.
+	if statesPlugin, ok := element.(*Plugin); ok {
+		for _, state := range statesPlugin.states {
+			p.addState(state)
+		}
+	}
 	if p.fixed { // The plugin version is fixed (= constraint)
 		return
 	}
@@ -478,3 +538,25 @@ func (p *Plugin) AddDependencyTo(depElement Element) {
 	// In short, depPlugin is required by p
 	depPlugin.parents[p.ExtensionName] = p
 }
+
+// parsePluginStates check a comma separated list of plugin states and return them sorted, without duplicates.
+func parsePluginStates(statesList string) (states []string, _ error) {
+	found := make(map[string]bool)
+	for _, state := range strings.Split(statesList, ",") {
+		state = strings.Trim(state, " ")
+		switch state {
+		case "":
+			continue
+		case PluginDisabled, PluginPinned:
+			found[state] = true
+		default:
+			return nil, fmt.Errorf("Invalid plugin state '%s'. Must be '%s' or '%s'", state, PluginDisabled, PluginPinned)
+		}
+	}
+	states = make([]string, 0, len(found))
+	for state := range found {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	return
+}
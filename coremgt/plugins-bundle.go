@@ -0,0 +1,305 @@
+package coremgt
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/forj-oss/forjj-modules/trace"
+)
+
+const (
+	// bundleManifestFile is the bundle manifest, first file of the bundle archive.
+	bundleManifestFile = ".jplugins-bundle.json"
+	// bundleFormat is the version of the bundle layout.
+	bundleFormat = 1
+)
+
+// BundleManifest describes the files of a bundle. Files are stored with their path in the Jenkins home,
+// so the bundle can be extracted as is in a Jenkins home, like an image layer.
+type BundleManifest struct {
+	Format  int          `json:"format"`
+	Created string       `json:"created"`
+	Jenkins string       `json:"jenkins,omitempty"` // Jenkins core locked. Its war is not bundled.
+	Files   []BundleFile `json:"files"`
+}
+
+// BundleFile is a file of the bundle, with its base64 sha256.
+type BundleFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+}
+
+// WriteBundle prepare plugins (downloaded and verified), groovies and files of the lock as they are installed
+// in a Jenkins home, and archive them in a tar.gz bundle with the lock file and a manifest.
+// Plugins are downloaded with jobs workers, through the plugins cache if not nil.
+func WriteBundle(elements *ElementsType, featureRepoPath, lockFile, bundleFile string, jobs int, cache *PluginsCache) (manifest *BundleManifest, err error) {
+	if err = elements.SetFeaturesPath(featureRepoPath); err != nil {
+		return
+	}
+	workPath, err := ioutil.TempDir("", "jplugins-bundle-")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create a temporary directory. %s", err)
+	}
+	defer os.RemoveAll(workPath)
+
+	work := NewJenkinsHome(workPath)
+	work.SetJobs(jobs)
+	work.SetCache(cache)
+	transaction, err := newInstallTransaction(workPath)
+	if err != nil {
+		return
+	}
+
+	if err = work.install(elements, featureRepoPath, transaction); err != nil {
+		return
+	}
+	data, err := ioutil.ReadFile(lockFile)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read '%s'. %s", lockFile, err)
+	}
+	if err = transaction.stageData(jenkinsHomeInstalledLock, data); err != nil {
+		return
+	}
+
+	manifest = new(BundleManifest)
+	manifest.Format = bundleFormat
+	manifest.Created = time.Now().UTC().Format(time.RFC3339)
+	if core := elements.JenkinsCore(); core != nil {
+		manifest.Jenkins = core.Version
+	}
+	for _, file := range sortedKeys(transaction.staged) {
+		stagingFile := path.Join(transaction.stagingPath, file)
+		info, err := os.Stat(stagingFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read '%s'. %s", stagingFile, err)
+		}
+		sha, err := fileSha256(stagingFile)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, BundleFile{Path: file, Size: info.Size(), Sha256: sha})
+	}
+
+	if err = manifest.writeArchive(transaction.stagingPath, bundleFile); err != nil {
+		return nil, fmt.Errorf("Unable to write '%s'. %s", bundleFile, err)
+	}
+	return
+}
+
+// InstallBundle install the Jenkins home from a bundle, with no network access.
+// Each file is verified with the bundle manifest. As with Install, files not in the bundle anymore are removed,
+// and files replaced or removed are saved in a snapshot.
+func (j *JenkinsHome) InstallBundle(bundleFile string) error {
+	return j.runInstall(func(transaction *installTransaction) error {
+		manifest, err := stageBundle(bundleFile, transaction)
+		if err != nil {
+			return fmt.Errorf("Invalid bundle '%s'. %s", bundleFile, err)
+		}
+		gotrace.Info("%d file(s) prepared from bundle '%s' created on %s.", len(manifest.Files), bundleFile, manifest.Created)
+		return nil
+	})
+}
+
+/************************************************************************
+ ***************** INTERNAL FUNCTIONS ***********************************
+ ************************************************************************/
+
+// writeArchive write the manifest, then files listed from sourcePath, in a tar.gz archive.
+// The archive is written to a temporary file, renamed when complete.
+func (m *BundleManifest) writeArchive(sourcePath, bundleFile string) (err error) {
+	tmpFile := bundleFile + ".tmp"
+	fd, err := os.Create(tmpFile)
+	if err != nil {
+		return
+	}
+	defer func() {
+		fd.Close()
+		if err != nil {
+			os.Remove(tmpFile)
+		}
+	}()
+
+	gzipWriter := gzip.NewWriter(fd)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return
+	}
+	if err = writeTarData(tarWriter, bundleManifestFile, append(data, '\n')); err != nil {
+		return
+	}
+	for _, file := range m.Files {
+		if err = writeTarFile(tarWriter, file.Path, path.Join(sourcePath, file.Path)); err != nil {
+			return
+		}
+	}
+
+	if err = tarWriter.Close(); err != nil {
+		return
+	}
+	if err = gzipWriter.Close(); err != nil {
+		return
+	}
+	if err = fd.Close(); err != nil {
+		return
+	}
+	return os.Rename(tmpFile, bundleFile)
+}
+
+// stageBundle extract bundle files in the transaction staging directory and verify them with the bundle manifest.
+func stageBundle(bundleFile string, transaction *installTransaction) (manifest *BundleManifest, err error) {
+	fd, err := os.Open(bundleFile)
+	if err != nil {
+		return
+	}
+	defer fd.Close()
+
+	gzipReader, err := gzip.NewReader(fd)
+	if err != nil {
+		return
+	}
+	tarReader := tar.NewReader(gzipReader)
+
+	header, err := tarReader.Next()
+	if err != nil || header.Name != bundleManifestFile {
+		return nil, fmt.Errorf("'%s' not found at the beginning of the bundle", bundleManifestFile)
+	}
+	manifest = new(BundleManifest)
+	if err = json.NewDecoder(tarReader).Decode(manifest); err != nil {
+		return nil, fmt.Errorf("Unable to read '%s'. %s", bundleManifestFile, err)
+	}
+	if manifest.Format != bundleFormat {
+		return nil, fmt.Errorf("Unsupported bundle format %d. Expect %d", manifest.Format, bundleFormat)
+	}
+
+	expected := make(map[string]BundleFile)
+	for _, file := range manifest.Files {
+		expected[file.Path] = file
+	}
+
+	for {
+		if header, err = tarReader.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			return
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		file := path.Clean(header.Name)
+		bundled, found := expected[file]
+		if !found || header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("'%s' is not described by the bundle manifest", header.Name)
+		}
+		if err = checkBundleFile(file); err != nil {
+			return
+		}
+		if err = stageBundleFile(tarReader, bundled, transaction); err != nil {
+			return
+		}
+		delete(expected, file)
+	}
+
+	if len(expected) > 0 {
+		missing := make([]string, 0, len(expected))
+		for file := range expected {
+			missing = append(missing, file)
+		}
+		sort.Strings(missing)
+		return nil, fmt.Errorf("Missing files: %s", strings.Join(missing, ", "))
+	}
+	return manifest, nil
+}
+
+// stageBundleFile write a bundle file in the staging directory and verify its sha256.
+func stageBundleFile(reader io.Reader, bundled BundleFile, transaction *installTransaction) (err error) {
+	stagingDir, err := transaction.stagingDir(path.Dir(bundled.Path))
+	if err != nil {
+		return
+	}
+	stagingFile := path.Join(stagingDir, path.Base(bundled.Path))
+	fd, err := os.Create(stagingFile)
+	if err != nil {
+		return
+	}
+	defer fd.Close()
+
+	sha256File := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(fd, sha256File), reader); err != nil {
+		return fmt.Errorf("Unable to extract '%s'. %s", bundled.Path, err)
+	}
+	if sha := base64.StdEncoding.EncodeToString(sha256File.Sum(nil)); sha != bundled.Sha256 {
+		return fmt.Errorf("'%s' has an invalid check sum. Expect '%s'. Got '%s'", bundled.Path, bundled.Sha256, sha)
+	}
+	transaction.stage(bundled.Path)
+	gotrace.Trace("Extracted: %s - sha256:%s", bundled.Path, bundled.Sha256)
+	return nil
+}
+
+// checkBundleFile verify a bundle file is installed in the Jenkins home, out of jplugins working directories.
+func checkBundleFile(file string) error {
+	if err := checkFileDest(file); err != nil {
+		return err
+	}
+	for _, workPath := range []string{jenkinsHomeStagingPath, jenkinsHomeBackupPath, jenkinsHomeBackupsPath} {
+		if file == workPath || strings.HasPrefix(file, workPath+"/") {
+			return fmt.Errorf("Invalid file '%s'. Must not be in '%s'", file, workPath)
+		}
+	}
+	return nil
+}
+
+// writeTarFile add a file to the tar archive, with the name given.
+func writeTarFile(tarWriter *tar.Writer, name, file string) error {
+	fd, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	info, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(name)
+	header.Mode = 0644
+	if err = tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tarWriter, fd)
+	return err
+}
+
+// writeTarData add data to the tar archive as a file.
+func writeTarData(tarWriter *tar.Writer, name string, data []byte) error {
+	header := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tarWriter.Write(data)
+	return err
+}
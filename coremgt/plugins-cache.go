@@ -0,0 +1,289 @@
+package coremgt
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/forj-oss/forjj-modules/trace"
+)
+
+const (
+	pluginsCacheBlobsPath = "sha256" // Plugin packages, named by their sha256 (hex).
+	pluginsCacheIndexPath = "index"  // `<plugin>@<version>` files, containing the package sha256 (hex).
+
+	// pluginsCacheGracePeriod is the minimum age of temporary files and packages not indexed before GC removes them.
+	// Younger ones can belong to an install running in parallel.
+	pluginsCacheGracePeriod = time.Hour
+)
+
+// PluginsCache is a local cache of plugin packages, shared by installs.
+// Packages are stored by sha256, and indexed by plugin name and version.
+type PluginsCache struct {
+	path    string
+	maxSize int64 // Maximum cache size in bytes. 0 means no limit.
+}
+
+// NewPluginsCache creates a PluginsCache object. maxSize is given in bytes. 0 means no limit.
+func NewPluginsCache(cachePath string, maxSize int64) (ret *PluginsCache) {
+	ret = new(PluginsCache)
+	ret.path = cachePath
+	ret.maxSize = maxSize
+	return
+}
+
+// Path return the cache directory.
+func (c *PluginsCache) Path() string {
+	if c == nil {
+		return ""
+	}
+	return c.path
+}
+
+// GC remove index entries of missing packages and packages not indexed.
+// If the cache is bigger than the maximum size, least recently used packages are removed.
+// Temporary files and packages not indexed are kept during pluginsCacheGracePeriod, as they can be
+// written by another install.
+func (c *PluginsCache) GC() (removed int, freed int64, err error) {
+	if c == nil {
+		return
+	}
+
+	blobs, err := ioutil.ReadDir(path.Join(c.path, pluginsCacheBlobsPath))
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("Unable to read the plugins cache '%s'. %s", c.path, err)
+	}
+
+	expired := time.Now().Add(-pluginsCacheGracePeriod)
+	indexed := make(map[string][]string) // sha256 => index entries
+	entries, _ := ioutil.ReadDir(path.Join(c.path, pluginsCacheIndexPath))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			// Temporary file being written, or left by an interrupted install.
+			if entry.ModTime().Before(expired) {
+				os.Remove(path.Join(c.path, pluginsCacheIndexPath, entry.Name()))
+			}
+			continue
+		}
+		data, err := ioutil.ReadFile(path.Join(c.path, pluginsCacheIndexPath, entry.Name()))
+		if err != nil {
+			continue
+		}
+		sha := strings.Trim(string(data), " \n")
+		indexed[sha] = append(indexed[sha], entry.Name())
+	}
+
+	var total int64
+	kept := make([]os.FileInfo, 0, len(blobs))
+	for _, blob := range blobs {
+		if !strings.HasSuffix(blob.Name(), ".hpi") {
+			// Temporary file being copied, or left by an interrupted copy.
+			if blob.ModTime().Before(expired) {
+				os.Remove(path.Join(c.path, pluginsCacheBlobsPath, blob.Name()))
+			}
+			continue
+		}
+		sha := strings.TrimSuffix(blob.Name(), ".hpi")
+		if _, found := indexed[sha]; !found {
+			if blob.ModTime().After(expired) {
+				// Probably added by an install not yet done with the index.
+				continue
+			}
+			if c.removeBlob(sha, nil) == nil {
+				removed++
+				freed += blob.Size()
+			}
+			continue
+		}
+		total += blob.Size()
+		kept = append(kept, blob)
+	}
+	for sha, names := range indexed {
+		if _, statErr := os.Stat(c.blobFile(sha)); os.IsNotExist(statErr) {
+			c.removeBlob(sha, names)
+		}
+	}
+
+	if c.maxSize > 0 && total > c.maxSize {
+		// Oldest first. The modification time is updated each time a package is used.
+		sort.Slice(kept, func(i, j int) bool {
+			return kept[i].ModTime().Before(kept[j].ModTime())
+		})
+		for _, blob := range kept {
+			if total <= c.maxSize {
+				break
+			}
+			sha := strings.TrimSuffix(blob.Name(), ".hpi")
+			if err = c.removeBlob(sha, indexed[sha]); err != nil {
+				return
+			}
+			removed++
+			freed += blob.Size()
+			total -= blob.Size()
+		}
+	}
+	return
+}
+
+/************************************************************************
+ ***************** INTERNAL FUNCTIONS ***********************************
+ ************************************************************************/
+
+// get return the cached package of a plugin version. If sha256 (base64) is given, the package must match it.
+// The cached package is verified before being returned.
+func (c *PluginsCache) get(name, version, sha256 string) (file string, _ bool) {
+	if c == nil {
+		return
+	}
+	sha := ""
+	if sha256 != "" {
+		data, err := base64.StdEncoding.DecodeString(sha256)
+		if err != nil {
+			return
+		}
+		sha = hex.EncodeToString(data)
+	} else if data, err := ioutil.ReadFile(c.indexFile(name, version)); err == nil {
+		sha = strings.Trim(string(data), " \n")
+	}
+	if sha == "" {
+		return
+	}
+
+	file = c.blobFile(sha)
+	fileSha, err := fileSha256(file)
+	if err != nil {
+		return "", false
+	}
+	if data, _ := base64.StdEncoding.DecodeString(fileSha); hex.EncodeToString(data) != sha {
+		gotrace.Warning("Cached package of %s %s is corrupted. Removed.", name, version)
+		c.removeBlob(sha, nil)
+		return "", false
+	}
+
+	now := time.Now()
+	os.Chtimes(file, now, now)
+	gotrace.Trace("%s %s found in the plugins cache.", name, version)
+	return file, true
+}
+
+// add store a plugin package in the cache, and index it by plugin name and version.
+func (c *PluginsCache) add(name, version, file string) (err error) {
+	if c == nil {
+		return
+	}
+	fileSha, err := fileSha256(file)
+	if err != nil {
+		return
+	}
+	data, _ := base64.StdEncoding.DecodeString(fileSha)
+	sha := hex.EncodeToString(data)
+
+	for _, dir := range []string{pluginsCacheBlobsPath, pluginsCacheIndexPath} {
+		if err = os.MkdirAll(path.Join(c.path, dir), 0755); err != nil {
+			return fmt.Errorf("Unable to create the plugins cache. %s", err)
+		}
+	}
+
+	if _, statErr := os.Stat(c.blobFile(sha)); os.IsNotExist(statErr) {
+		if err = copyFileAtomic(file, c.blobFile(sha)); err != nil {
+			return fmt.Errorf("Unable to add %s %s to the plugins cache. %s", name, version, err)
+		}
+	} else {
+		// Already cached. Touched, so that a parallel GC does not remove it before it is indexed.
+		now := time.Now()
+		os.Chtimes(c.blobFile(sha), now, now)
+	}
+
+	if err = writeFileAtomic(c.indexFile(name, version), []byte(sha+"\n")); err != nil {
+		return fmt.Errorf("Unable to index %s %s in the plugins cache. %s", name, version, err)
+	}
+	gotrace.Trace("%s %s added to the plugins cache.", name, version)
+	return
+}
+
+// link create the destination file from the cached package.
+// The package is copied, not hard linked, so that changes to the installed file (content or
+// modification time) never alter the cache entry.
+func (c *PluginsCache) link(cachedFile, destFile string) error {
+	return copyFileAtomic(cachedFile, destFile)
+}
+
+// removeBlob remove a package and its index entries.
+func (c *PluginsCache) removeBlob(sha string, indexEntries []string) error {
+	for _, entry := range indexEntries {
+		os.Remove(path.Join(c.path, pluginsCacheIndexPath, entry))
+	}
+	if err := os.Remove(c.blobFile(sha)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Unable to remove '%s'. %s", c.blobFile(sha), err)
+	}
+	return nil
+}
+
+func (c *PluginsCache) blobFile(sha string) string {
+	return path.Join(c.path, pluginsCacheBlobsPath, sha+".hpi")
+}
+
+func (c *PluginsCache) indexFile(name, version string) string {
+	return path.Join(c.path, pluginsCacheIndexPath, path.Base(name)+"@"+version)
+}
+
+// writeFileAtomic write data to a temporary file next to the destination, then rename it.
+// The temporary file name is unique, so that concurrent writers do not collide.
+func writeFileAtomic(dest string, data []byte) (err error) {
+	tmpfd, err := ioutil.TempFile(path.Dir(dest), "."+path.Base(dest)+"-")
+	if err != nil {
+		return
+	}
+	_, err = tmpfd.Write(data)
+	if closeErr := tmpfd.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpfd.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmpfd.Name(), dest)
+	}
+	if err != nil {
+		os.Remove(tmpfd.Name())
+	}
+	return
+}
+
+// copyFileAtomic copy a file to a temporary file next to the destination, then rename it.
+func copyFileAtomic(source, dest string) (err error) {
+	srcfd, err := os.Open(source)
+	if err != nil {
+		return
+	}
+	defer srcfd.Close()
+
+	tmpfd, err := ioutil.TempFile(path.Dir(dest), "."+path.Base(dest)+"-")
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(tmpfd, srcfd)
+	if closeErr := tmpfd.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpfd.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmpfd.Name(), dest)
+	}
+	if err != nil {
+		os.Remove(tmpfd.Name())
+	}
+	return
+}
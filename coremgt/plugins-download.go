@@ -0,0 +1,92 @@
+package coremgt
+
+import (
+	"path"
+	"sync"
+
+	"github.com/forj-oss/forjj-modules/trace"
+)
+
+// DefaultJobs is the default number of plugins downloaded in parallel.
+const DefaultJobs = 4
+
+// pluginDownload is a plugin to install. If not kept, it is downloaded and verified by a download worker.
+type pluginDownload struct {
+	details *pluginsStatusDetails
+	archive string // Plugin archive file name in the plugins directory.
+	kept    bool   // true if already installed with the expected sha256.
+	err     error
+}
+
+// prepareDownloads identify plugins already installed and download others in the staging directory,
+// with a pool of workers. Results are returned by plugin name, to be reported in order.
+func (j *JenkinsHome) prepareDownloads(elementsType *ElementsType, transaction *installTransaction) (downloads map[string]*pluginDownload, err error) {
+	downloads = make(map[string]*pluginDownload)
+	queue := make([]*pluginDownload, 0)
+
+	for name, element := range elementsType.list[pluginType] {
+		plugin := element.(*Plugin)
+		if plugin.Version == "" {
+			continue
+		}
+		download := new(pluginDownload)
+		downloads[name] = download
+		if download.archive, download.kept = j.installedPlugin(plugin); download.kept {
+			continue
+		}
+
+		download.archive = path.Base(plugin.ExtensionName) + ".hpi"
+		download.details = newPluginsStatusDetails()
+		download.details.setVersion(plugin.Version)
+		download.details.name = plugin.ExtensionName
+		download.details.newSha256Version = plugin.checkSumSha256
+		download.details.cache = j.cache
+		queue = append(queue, download)
+	}
+	if len(queue) == 0 {
+		return
+	}
+
+	stagingDir, err := transaction.stagingDir(jenkinsHomePluginsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := j.jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > len(queue) {
+		jobs = len(queue)
+	}
+	gotrace.Info("Downloading %d plugin(s), %d at a time...", len(queue), jobs)
+	runDownloads(queue, stagingDir, jobs)
+	return
+}
+
+/************************************************************************
+ ***************** INTERNAL FUNCTIONS ***********************************
+ ************************************************************************/
+
+// runDownloads download and verify plugins with jobs workers. Each download result is stored in its err field.
+func runDownloads(queue []*pluginDownload, stagingDir string, jobs int) {
+	downloads := make(chan *pluginDownload)
+	var workers sync.WaitGroup
+
+	for worker := 0; worker < jobs; worker++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for download := range downloads {
+				download.err = download.details.installIt(stagingDir)
+				gotrace.Trace("%s downloaded.", download.details.name)
+			}
+		}()
+	}
+
+	for _, download := range queue {
+		downloads <- download
+	}
+	close(downloads)
+	workers.Wait()
+}
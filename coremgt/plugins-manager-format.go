@@ -0,0 +1,230 @@
+package coremgt
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"jplugins/simplefile"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Formats of the Jenkins plugin installation manager (and the official docker image install-plugins.sh)
+const (
+	PluginsTxtFormat  = "plugins.txt"
+	PluginsYamlFormat = "plugins.yaml"
+)
+
+// pluginsYaml is the plugin installation manager `plugins.yaml` representation.
+type pluginsYaml struct {
+	Plugins []pluginYaml `yaml:"plugins"`
+}
+
+type pluginYaml struct {
+	ArtifactID string            `yaml:"artifactId"`
+	GroupID    string            `yaml:"groupId,omitempty"`
+	Source     *pluginYamlSource `yaml:"source,omitempty"`
+}
+
+type pluginYamlSource struct {
+	Version string `yaml:"version,omitempty"`
+	URL     string `yaml:"url,omitempty"`
+}
+
+// PluginsImport is a list of plugins imported from a plugins.txt or plugins.yaml file.
+// Entries jplugins cannot manage (experimental, incrementals, URL) are imported without version, with a warning.
+type PluginsImport struct {
+	plugins  map[string]string // Plugin name => version. Empty for latest.
+	Warnings []string
+}
+
+// ImportPlugins read a plugins.txt or plugins.yaml file. If format is empty, it is detected from the file extension.
+func ImportPlugins(file, format string) (imported *PluginsImport, err error) {
+	if format == "" {
+		format = PluginsTxtFormat
+		if strings.HasSuffix(file, ".yaml") || strings.HasSuffix(file, ".yml") {
+			format = PluginsYamlFormat
+		}
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read '%s'. %s", file, err)
+	}
+
+	imported = new(PluginsImport)
+	imported.plugins = make(map[string]string)
+	switch format {
+	case PluginsTxtFormat:
+		err = imported.readTxt(data)
+	case PluginsYamlFormat:
+		err = imported.readYaml(data)
+	default:
+		err = fmt.Errorf("Unsupported format '%s'. Expect '%s' or '%s'", format, PluginsTxtFormat, PluginsYamlFormat)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to import '%s'. %s", file, err)
+	}
+	return
+}
+
+// Length return the number of plugins imported.
+func (i *PluginsImport) Length() int {
+	if i == nil {
+		return 0
+	}
+	return len(i.plugins)
+}
+
+// WriteSimple write plugins imported in the features file format. (`plugin:<name>[:<version>]`)
+func (i *PluginsImport) WriteSimple(file string) (err error) {
+	if i == nil {
+		return
+	}
+	featureFile := simplefile.NewSimpleFile(file, 3)
+	for name, version := range i.plugins {
+		fields := []string{pluginType, name}
+		if version != "" {
+			fields = append(fields, version)
+		}
+		featureFile.AddWithKeyString(name, fields...)
+	}
+	return featureFile.WriteSorted(":")
+}
+
+// ExportPlugins write the locked plugins in plugins.txt or plugins.yaml format.
+// Elements which cannot be exported (groovies, files and plugin states) are counted in skipped.
+func ExportPlugins(elements *ElementsType, format string, out io.Writer) (skipped int, err error) {
+	plugins := elements.GetElements(pluginType)
+	names := sortedElementNames(plugins)
+	for _, elementType := range []string{groovyType, cascType, fileType} {
+		skipped += len(elements.GetElements(elementType))
+	}
+
+	var data bytes.Buffer
+	switch format {
+	case PluginsTxtFormat:
+		for _, name := range names {
+			plugin := plugins[name].(*Plugin)
+			if plugin.Version == "" {
+				continue
+			}
+			fmt.Fprintf(&data, "%s:%s\n", name, plugin.Version)
+			skipped += len(plugin.states)
+		}
+	case PluginsYamlFormat:
+		list := pluginsYaml{Plugins: make([]pluginYaml, 0, len(names))}
+		for _, name := range names {
+			plugin := plugins[name].(*Plugin)
+			if plugin.Version == "" {
+				continue
+			}
+			list.Plugins = append(list.Plugins, pluginYaml{ArtifactID: name, Source: &pluginYamlSource{Version: plugin.Version}})
+			skipped += len(plugin.states)
+		}
+		yamlData, err := yaml.Marshal(&list)
+		if err != nil {
+			return 0, fmt.Errorf("Unable to encode plugins as yaml. %s", err)
+		}
+		data.Write(yamlData)
+	default:
+		return 0, fmt.Errorf("Unsupported format '%s'. Expect '%s' or '%s'", format, PluginsTxtFormat, PluginsYamlFormat)
+	}
+
+	_, err = data.WriteTo(out)
+	return
+}
+
+/************************************************************************
+ ***************** INTERNAL FUNCTIONS ***********************************
+ ************************************************************************/
+
+// readTxt read plugins.txt lines: `<name>[:<version>[:<url>]]`
+// version can be `latest`, `experimental` or `incrementals;<groupId>;<version>`. Comments start with '#'.
+func (i *PluginsImport) readTxt(data []byte) error {
+	lineNumber := 0
+	fileScan := bufio.NewScanner(bytes.NewReader(data))
+	for fileScan.Scan() {
+		lineNumber++
+		line := fileScan.Text()
+		if index := strings.Index(line, "#"); index >= 0 {
+			line = line[:index]
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+
+		// The URL can contain ':'
+		fields := strings.SplitN(line, ":", 3)
+		name := strings.TrimSpace(fields[0])
+		if name == "" {
+			i.warning("Line %d: no plugin name in '%s'. Ignored.", lineNumber, line)
+			continue
+		}
+		version, url := "", ""
+		if len(fields) >= 2 {
+			version = strings.TrimSpace(fields[1])
+		}
+		if len(fields) == 3 {
+			url = strings.TrimSpace(fields[2])
+		}
+		if len(fields) == 3 && strings.HasPrefix(url, "//") {
+			// `<name>:<url>`, without version.
+			version, url = "", version+":"+url
+		}
+		i.add(name, version, "", url)
+	}
+	return fileScan.Err()
+}
+
+// readYaml read the plugins list of a plugins.yaml file.
+func (i *PluginsImport) readYaml(data []byte) error {
+	var list pluginsYaml
+	if err := yaml.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	for index, plugin := range list.Plugins {
+		if plugin.ArtifactID == "" {
+			i.warning("Plugin %d: no artifactId. Ignored.", index+1)
+			continue
+		}
+		version, url := "", ""
+		if plugin.Source != nil {
+			version = plugin.Source.Version
+			url = plugin.Source.URL
+		}
+		i.add(plugin.ArtifactID, version, plugin.GroupID, url)
+	}
+	return nil
+}
+
+// add register a plugin with a version jplugins can resolve from the updates center.
+// A groupID with a `-rc` version is an incrementals version.
+func (i *PluginsImport) add(name, version, groupID, url string) {
+	switch {
+	case url != "":
+		i.warning("%s: download URL '%s' is not supported. The updates center version is used.", name, url)
+		if version == "latest" || version == "experimental" {
+			version = ""
+		}
+	case strings.HasPrefix(version, "incrementals;"), groupID != "" && strings.Contains(version, "-rc"):
+		i.warning("%s: incrementals version '%s' is not supported. Latest released version is used.", name, version)
+		version = ""
+	case version == "experimental":
+		i.warning("%s: experimental update center is not supported. Latest released version is used.", name)
+		version = ""
+	case version == "latest":
+		version = ""
+	}
+
+	if existing, found := i.plugins[name]; found && existing != version {
+		i.warning("%s: declared several times. Version '%s' replaced by '%s'.", name, existing, version)
+	}
+	i.plugins[name] = version
+}
+
+func (i *PluginsImport) warning(format string, args ...interface{}) {
+	i.Warnings = append(i.Warnings, fmt.Sprintf(format, args...))
+}
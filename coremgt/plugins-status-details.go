@@ -1,24 +1,15 @@
 package coremgt
 
 import (
-	"crypto/sha256"
-	"encoding/base64"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
 	"path"
-	"time"
+	"strings"
 
 	"github.com/forj-oss/forjj-modules/trace"
 	goversion "github.com/hashicorp/go-version"
 )
 
-const (
-	retrySleepTime = 30 * time.Second
-	retryLimit     = 3
-)
-
 type pluginsStatusDetails struct {
 	name             string
 	title            string
@@ -32,6 +23,10 @@ type pluginsStatusDetails struct {
 	latest           bool
 	rules            map[string]goversion.Constraints
 	preInstalled     bool
+	features         []string // features which declared this plugin.
+	states           []string // plugin states (disabled, pinned) to install.
+	cache            *PluginsCache
+	fromCache        bool // true if installed from the plugins cache.
 }
 
 func newPluginsStatusDetails() (ret *pluginsStatusDetails) {
@@ -72,6 +67,48 @@ func (sd *pluginsStatusDetails) setAsPreInstalled() *pluginsStatusDetails {
 	return sd
 }
 
+// addFeature attribute the plugin to the feature which declared it.
+func (sd *pluginsStatusDetails) addFeature(name string) {
+	if sd == nil {
+		return
+	}
+	for _, feature := range sd.features {
+		if feature == name {
+			return
+		}
+	}
+	sd.features = append(sd.features, name)
+}
+
+// featuresString return the list of features which declared the plugin, for display.
+func (sd *pluginsStatusDetails) featuresString() string {
+	if sd == nil || len(sd.features) == 0 {
+		return ""
+	}
+	return " (feature: " + strings.Join(sd.features, ", ") + ")"
+}
+
+// addStates add the plugin states given as a comma separated list. (disabled, pinned)
+func (sd *pluginsStatusDetails) addStates(statesList string) error {
+	if sd == nil {
+		return nil
+	}
+	states, err := parsePluginStates(sd.statesString() + "," + statesList)
+	if err != nil {
+		return fmt.Errorf("Plugin '%s': %s", sd.name, err)
+	}
+	sd.states = states
+	return nil
+}
+
+// statesString return the plugin states as written in the lock file.
+func (sd *pluginsStatusDetails) statesString() string {
+	if sd == nil {
+		return ""
+	}
+	return strings.Join(sd.states, ",")
+}
+
 func (sd *pluginsStatusDetails) setVersion(version string) *pluginsStatusDetails {
 	if sd == nil {
 		return nil
@@ -157,27 +194,13 @@ func (sd *pluginsStatusDetails) setIsLatest() {
 }
 
 func (sd *pluginsStatusDetails) packageAvailable(version *goversion.Version) (found bool) {
-	var resp *http.Response
 	pluginURL := JenkinsRepoURL + "/" + JenkinsPluginRepo + "/" + sd.name + "/" + version.Original() + "/" + path.Base(sd.name) + ".hpi"
 	gotrace.Trace("Checking package from %s", pluginURL)
-	retry := 0
-	for {
-		var err error
-
-		resp, err = http.Get(pluginURL)
-		if err == nil {
-			break
-		}
-
-		if retry > retryLimit {
-			return
-
-		}
-		retry++
-		time.Sleep(retrySleepTime)
-		fmt.Printf("%d ", retry)
+	resp, err := httpRequest("HEAD", pluginURL)
+	if err != nil {
+		gotrace.Trace("%s", err)
+		return
 	}
-
 	defer resp.Body.Close()
 
 	if resp.StatusCode == 404 {
@@ -186,51 +209,47 @@ func (sd *pluginsStatusDetails) packageAvailable(version *goversion.Version) (fo
 	return true
 }
 
+// packageSize return the size of the plugin package to download, as given by the updates server.
+// -1 is returned if the size is unknown.
+func (sd *pluginsStatusDetails) packageSize() int64 {
+	pluginURL := JenkinsRepoURL + "/" + JenkinsPluginRepo + "/" + sd.name + "/" + sd.newVersion.String() + "/" + path.Base(sd.name) + ".hpi"
+	gotrace.Trace("Checking package size from %s", pluginURL)
+	resp, err := httpRequest("HEAD", pluginURL)
+	if err != nil {
+		gotrace.Trace("Unable to get '%s' size. %s", pluginURL, err)
+		return -1
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return -1
+	}
+	return resp.ContentLength
+}
+
 func (sd *pluginsStatusDetails) installIt(destPath string) (err error) {
-	var resp *http.Response
 	pluginURL := JenkinsRepoURL + "/" + JenkinsPluginRepo + "/" + sd.name + "/" + sd.newVersion.String() + "/" + path.Base(sd.name) + ".hpi"
 	destFile := path.Join(destPath, path.Base(sd.name)+".hpi")
 
-	retry := 0
-	for {
-		if resp, err = http.Get(pluginURL); err == nil {
-			break
+	if cachedFile, found := sd.cache.get(sd.name, sd.newVersion.String(), sd.newSha256Version); found {
+		if err = sd.cache.link(cachedFile, destFile); err != nil {
+			return fmt.Errorf("Unable to copy %s to %s. %s", cachedFile, destFile, err)
 		}
-
-		if retry > retryLimit {
-			err = fmt.Errorf("Unable to read '%s'. %s", pluginURL, err)
+		if sd.newSha256Version != "" {
+			sd.checkSumVerified = true
+		} else if sd.newSha256Version, err = fileSha256(destFile); err != nil {
 			return
-
 		}
-		retry++
-		time.Sleep(retrySleepTime)
-		fmt.Printf("%d ", retry)
-	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode == 404 {
-		return fmt.Errorf("File %s not found", pluginURL)
-	}
-
-	var destfd *os.File
-	destfd, err = os.Create(destFile)
-	if err != nil {
-		return err
+		sd.fromCache = true
+		gotrace.Trace("Copied: %s => %s - sha256:%s", cachedFile, destFile, sd.newSha256Version)
+		return nil
 	}
-	defer destfd.Close()
-
-	sha256File := sha256.New()
-	// write to sha256File while reading the data from updates
-	teeFile := io.TeeReader(resp.Body, sha256File)
 
-	// Execute the copy from updates and do the sha256 at the same time.
-	_, err = io.Copy(destfd, teeFile)
+	downloadedSHA256, err := httpDownload(pluginURL, destFile)
 	if err != nil {
 		return fmt.Errorf("Unable to copy %s to %s. %s", pluginURL, destFile, err)
 	}
 
-	downloadedSHA256 := base64.StdEncoding.EncodeToString(sha256File.Sum(nil))
 	if sd.newSha256Version != "" {
 		if sd.newSha256Version != downloadedSHA256 {
 			return fmt.Errorf("Failed to copy %s to %s. %s has an invalid check sum. Expect '%s'. Got '%s'", pluginURL, destFile, path.Base(sd.name)+".hpi", sd.newSha256Version, downloadedSHA256)
@@ -243,5 +262,8 @@ func (sd *pluginsStatusDetails) installIt(destPath string) (err error) {
 
 	gotrace.Trace("Copied: %s => %s - sha256:%s", pluginURL, destFile, downloadedSHA256)
 
+	if err = sd.cache.add(sd.name, sd.newVersion.String(), destFile); err != nil {
+		gotrace.Warning("%s", err)
+	}
 	return nil
 }
@@ -2,10 +2,11 @@ package coremgt
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"jplugins/simplefile"
 	"net/url"
-	"os"
 	"path"
 	"sort"
 	"strconv"
@@ -13,8 +14,6 @@ import (
 
 	"github.com/forj-oss/utils"
 
-	"github.com/forj-oss/go-git"
-
 	"github.com/forj-oss/forjj-modules/trace"
 )
 
@@ -24,12 +23,19 @@ import (
 type PluginsStatus struct {
 	plugins       map[string]*pluginsStatusDetails
 	groovies      map[string]*GroovyStatusDetails
+	files         map[string]*FileStatusDetails
 	PluginsStatus map[string]*pluginsStatusDetails
 	installed     *ElementsType
 	ref           *Repository
 	repoPath      string
 	repoURL       []*url.URL
+	repoRef       string
 	useLocal      bool
+	featuresRepo  *FeaturesRepo
+	featuresRepos *featuresRepos
+	sources       *LockSources
+	features      map[string]string // Features loaded with the commit ID they are pinned to. Empty for HEAD.
+	core          *JenkinsCore      // Jenkins core locked. nil if not locked.
 }
 
 // NewPluginsStatus creates an a plugin update status with a Ref repository
@@ -37,22 +43,40 @@ func NewPluginsStatus(installed *ElementsType, ref *Repository) (pluginsCompared
 	pluginsCompared = new(PluginsStatus)
 	pluginsCompared.plugins = make(map[string]*pluginsStatusDetails)
 	pluginsCompared.groovies = make(map[string]*GroovyStatusDetails)
+	pluginsCompared.files = make(map[string]*FileStatusDetails)
 	pluginsCompared.installed = installed
 	pluginsCompared.ref = ref
 	pluginsCompared.repoURL = make([]*url.URL, 0, 3)
+	pluginsCompared.featuresRepos = newFeaturesRepos()
+	pluginsCompared.sources = NewLockSources()
+	pluginsCompared.features = make(map[string]string)
 	return
 }
 
-// WriteSimple write list of plugins and groovies in a simple file format.
+// WriteSimple write list of plugins, groovies and feature files in a simple file format.
 func (s *PluginsStatus) WriteSimple(file string) (err error) {
-	lockFile := simplefile.NewSimpleFile(file, 3)
+	lockFile := simplefile.NewSimpleFile(file, 5)
 
 	for name, plugin := range s.plugins {
-		lockFile.AddWithKeyString("1-"+name, "plugin", name, plugin.newVersion.String())
+		fields := []string{"plugin", name, plugin.newVersion.String()}
+		if states := plugin.statesString(); states != "" {
+			fields = append(fields, states)
+		}
+		lockFile.AddWithKeyString("1-"+name, fields...)
 	}
 	for name, groovy := range s.groovies {
-		lockFile.AddWithKeyString("2-"+name, "groovy", name, groovy.newCommit)
+		fields := []string{"groovy", name, groovy.newCommit}
+		if groovy.repoName != "" {
+			fields = append(fields, groovy.repoName)
+		}
+		lockFile.AddWithKeyString("2-"+name, fields...)
+	}
+	for name, file := range s.files {
+		lockFile.AddWithKeyString("3-"+file.fileType+"-"+name, file.lockFields()...)
 	}
+	s.featuresRepos.addToLockFile(lockFile)
+	s.sources.addToLockFile(lockFile)
+	s.core.addToLockFile(lockFile)
 
 	err = lockFile.WriteSorted(":")
 	if err != nil {
@@ -61,6 +85,24 @@ func (s *PluginsStatus) WriteSimple(file string) (err error) {
 	return
 }
 
+// AddSourceFile record the hash of a file used to build the lock data. (jplugins.lst)
+// name is the file reference stored in the lock file.
+func (s *PluginsStatus) AddSourceFile(sourceType, name, file string) error {
+	if s == nil {
+		return nil
+	}
+	return s.sources.AddFile(sourceType, name, "", file)
+}
+
+// AddFeaturesRepo register a named features repository. (`repo:<name>:<url>`)
+// Features of this repository are referenced as `feature:<name>/<feature>`
+func (s *PluginsStatus) AddFeaturesRepo(name, repoURL string) error {
+	if s == nil {
+		return nil
+	}
+	return s.featuresRepos.add(name, repoURL)
+}
+
 // SetLocal set the useLocal to true
 // When set to true, jplugin do not clone a remote repo URL to store on cache
 func (s *PluginsStatus) SetLocal() {
@@ -85,6 +127,14 @@ func (s *PluginsStatus) SetFeaturesRepoURL(repoURL string) error {
 	return nil
 }
 
+// SetFeaturesRepoRef defines the branch, tag or commit ID of the features repository to checkout.
+func (s *PluginsStatus) SetFeaturesRepoRef(ref string) {
+	if s == nil {
+		return
+	}
+	s.repoRef = ref
+}
+
 // SetFeaturesPath defines where a features repository is located like `jenkins-install-inits`
 func (s *PluginsStatus) SetFeaturesPath(repoPath string) error {
 	if s == nil {
@@ -108,6 +158,14 @@ func (s *PluginsStatus) NewInstall() {
 	for name, groovy := range s.installed.list["groovy"] {
 		s.groovies[name] = groovy.AsNewGrooviesStatusDetails(s.installed)
 	}
+	for _, elementType := range []string{cascType, fileType} {
+		for _, element := range s.installed.list[elementType] {
+			if file, ok := element.(*FeatureFile); ok {
+				sd := file.asNewFileStatusDetails(s.installed)
+				s.files[sd.name] = sd
+			}
+		}
+	}
 }
 
 // Compare only plugins against repository.
@@ -170,6 +228,8 @@ func (s *PluginsStatus) AddElement(element Element, old bool) (err error) {
 		err = s.AddPluginStatus(element.(*Plugin), old)
 	case groovyType:
 		err = s.AddGroovyStatus(element.(*Groovy), old)
+	case cascType, fileType:
+		err = s.AddFileStatus(element.(*FeatureFile), old)
 	default:
 		return fmt.Errorf("%s type is not treated", elementType)
 	}
@@ -243,6 +303,7 @@ func (s *PluginsStatus) AddGroovyStatus(groovy *Groovy, old bool) (_ error) {
 
 	if !found {
 		groovyStatus = newGroovyStatusDetails(groovy.Name(), "")
+		groovyStatus.repoName = groovy.repoName
 		s.groovies[groovy.Name()] = groovyStatus
 	}
 	if old {
@@ -259,6 +320,35 @@ func (s *PluginsStatus) AddGroovyStatus(groovy *Groovy, old bool) (_ error) {
 	return
 }
 
+// AddFileStatus register the feature file version as an old or new file
+func (s *PluginsStatus) AddFileStatus(file *FeatureFile, old bool) (_ error) {
+	if s == nil {
+		return fmt.Errorf("PluginsStatus object is nil")
+	}
+
+	var version *string
+	fileStatus, found := s.files[file.Name()]
+
+	if !found {
+		fileStatus = newFileStatusDetails(file.fileType, file.Name(), file.Dest, "")
+		fileStatus.repoName = file.repoName
+		s.files[file.Name()] = fileStatus
+	}
+	if old {
+		version = &fileStatus.oldCommit
+	} else {
+		version = &fileStatus.newCommit
+		fileStatus.dest = file.Dest
+	}
+
+	if *version != "" {
+		return fmt.Errorf("Unable to update the %s file status %s with version %s. Already set", fileStatus.fileType, fileStatus.name, file.CommitID)
+	}
+	*version = file.CommitID
+
+	return
+}
+
 // chooseNewVersion change the default new version of a locked plugin
 func (s *PluginsStatus) chooseNewVersion(name, version string) (_ bool) {
 	pluginLock, found := s.plugins[name]
@@ -286,13 +376,17 @@ func (s *PluginsStatus) addPlugin(version VersionStruct, pluginRef *RepositoryPl
 	return
 }
 
-func (s *PluginsStatus) addGroovy(name string, sourcePath string) (ret *GroovyStatusDetails) {
+func (s *PluginsStatus) addGroovy(name, repoName, ref, sourcePath string) (ret *GroovyStatusDetails) {
 	groovy, found := s.groovies[name]
 
 	if !found {
 		groovy = newGroovyStatusDetails(name, sourcePath)
+		groovy.repoName = repoName
+		groovy.ref = ref
+	}
+	if !groovy.defineVersion(!found) {
+		return nil
 	}
-	groovy.defineVersion(!found)
 	return groovy
 }
 
@@ -312,8 +406,8 @@ func (s *PluginsStatus) DisplayUpdates() (_ bool) {
 		return
 	}
 
-	if len(s.plugins) == 0 && len(s.groovies) == 0 {
-		fmt.Println("No plugins or groovies updates detected.")
+	if len(s.plugins) == 0 && len(s.groovies) == 0 && len(s.files) == 0 {
+		fmt.Println("No plugins, groovies or files updates detected.")
 		return true
 	}
 
@@ -335,7 +429,7 @@ func (s *PluginsStatus) DisplayUpdates() (_ bool) {
 			latestTag = "X"
 		}
 		if old := plugin.oldVersion.String(); old == plugin.newVersion.String() {
-			fmt.Printf("%s%s | %-"+strconv.Itoa(iMaxTitle+3)+"s : %s\n", newTag, latestTag, title+" ("+plugin.name+")", old)
+			fmt.Printf("%s%s | %-"+strconv.Itoa(iMaxTitle+3)+"s : %s%s\n", newTag, latestTag, title+" ("+plugin.name+")", old, plugin.featuresString())
 		} else {
 			iCountUpdated++
 			if old == "new" {
@@ -343,7 +437,7 @@ func (s *PluginsStatus) DisplayUpdates() (_ bool) {
 				newTag = "X"
 				old = ""
 			}
-			fmt.Printf("%s%s | %-"+strconv.Itoa(iMaxTitle+3)+"s : %-10s => %s\n", newTag, latestTag, title+" ("+plugin.name+")", old, plugin.newVersion)
+			fmt.Printf("%s%s | %-"+strconv.Itoa(iMaxTitle+3)+"s : %-10s => %s%s\n", newTag, latestTag, title+" ("+plugin.name+")", old, plugin.newVersion, plugin.featuresString())
 		}
 
 	}
@@ -383,12 +477,55 @@ func (s *PluginsStatus) DisplayUpdates() (_ bool) {
 
 	}
 
+	iCountFileUpdated, iCountFileNew := s.displayFilesUpdates()
+
 	fmt.Printf("\nFound %d/%d plugin(s) updates available. %d are new.\n", iCountUpdated, len(s.plugins), iCountNew)
 	fmt.Printf("Found %d/%d groovy(ies) updates available. %d are new.\n", iCountGroovyUpdated, iCountGroovy, iCountGroovyNew)
+	if len(s.files) > 0 {
+		fmt.Printf("Found %d/%d file(s) updates available. %d are new.\n", iCountFileUpdated, len(s.files), iCountFileNew)
+	}
 
 	return true
 }
 
+// displayFilesUpdates show feature files (casc and file) updates. Nothing is displayed without files.
+func (s *PluginsStatus) displayFilesUpdates() (iCountUpdated, iCountNew int) {
+	if len(s.files) == 0 {
+		return
+	}
+
+	filesList := make([]string, 0, len(s.files))
+	iMaxTitle := 0
+	for name, file := range s.files {
+		filesList = append(filesList, name)
+		if val := len(file.fileType + ":" + name); val > iMaxTitle {
+			iMaxTitle = val
+		}
+	}
+	sort.Strings(filesList)
+
+	fmt.Print("\nFiles:\n==========\n+-- New file\n|+- Latest version\nvv\n")
+
+	for _, name := range filesList {
+		file := s.files[name]
+		latestTag := " "
+		newTag := " "
+		title := file.fileType + ":" + name
+		if old := file.oldCommit; old == file.newCommit {
+			fmt.Printf("%s%s | %-"+strconv.Itoa(iMaxTitle)+"s : %s (%s)\n", newTag, latestTag, title, file.newCommit, file.dest)
+		} else {
+			iCountUpdated++
+			if old == "" {
+				iCountNew++
+				old = "new"
+				newTag = "X"
+			}
+			fmt.Printf("%s%s | %-"+strconv.Itoa(iMaxTitle)+"s : %-30s => %s (%s)\n", newTag, latestTag, title, old, file.newCommit, file.dest)
+		}
+	}
+	return
+}
+
 // ImportInstalled import a list of plugins considered as pre-installed
 // It stores the list of plugins and constraints '>=' in the structure, so those plugins are installed at minimum to that list.
 func (s *PluginsStatus) ImportInstalled(elements *ElementsType) {
@@ -415,9 +552,10 @@ func (s *PluginsStatus) ImportInstalled(elements *ElementsType) {
 }
 
 // CheckElement call split function and ensure a type and a name are given.
-func CheckElement(fields []string, split func(string, string, string)) {
+// The 4th field is given as options. (plugin states)
+func CheckElement(fields []string, split func(string, string, string, string)) {
 	var ftype, fname string
-	var fversion string
+	var fversion, foptions string
 
 	switch len(fields) {
 	case 1:
@@ -429,14 +567,22 @@ func CheckElement(fields []string, split func(string, string, string)) {
 	default:
 		ftype = strings.Trim(fields[0], " ")
 		fname = strings.Trim(fields[1], " ")
-		fversion = strings.Trim(fields[2], " ")
+		if ftype == repoType {
+			// The repository URL can contain ':'
+			fversion = strings.Trim(strings.Join(fields[2:], ":"), " ")
+		} else {
+			fversion = strings.Trim(fields[2], " ")
+			if len(fields) > 3 {
+				foptions = strings.Trim(fields[3], " ")
+			}
+		}
 	}
 
-	split(ftype, fname, fversion)
+	split(ftype, fname, fversion, foptions)
 }
 
 // CheckElementLine analyzes a line and split with the split function.
-func (s *PluginsStatus) CheckElementLine(line string, split func(string, string, string)) {
+func (s *PluginsStatus) CheckElementLine(line string, split func(string, string, string, string)) {
 	if line == "" || line[0] == '#' {
 		return
 	}
@@ -445,42 +591,89 @@ func (s *PluginsStatus) CheckElementLine(line string, split func(string, string,
 	CheckElement(fields, split)
 }
 
-func (s *PluginsStatus) CheckFeature(name string) (_ error) {
+// CheckFeature load the feature descriptor and check each element of it.
+// If ref is given (branch, tag or commit ID), the descriptor and groovies are read at this revision.
+//
+// A feature descriptor can include other features. They are loaded recursively, once.
+func (s *PluginsStatus) CheckFeature(name, ref string) (_ error) {
 	if s == nil {
 		return
 	}
-	if !s.useLocal {
-		return fmt.Errorf("Git clone of repository not currently implemented. Do git task and use --features-repo-path")
-	}
+	return s.checkFeature(name, ref, nil)
+}
 
-	if err := git.RunInPath(s.repoPath, func() error {
-		if git.Do("rev-parse", "--git-dir") != 0 {
-			return fmt.Errorf("Not a valid GIT repository")
+// checkFeature load a feature descriptor. including is the list of features which includes this one.
+func (s *PluginsStatus) checkFeature(name, ref string, including []string) (_ error) {
+	for _, parent := range including {
+		if parent == name {
+			return fmt.Errorf("Features cycle detected: %s -> %s", strings.Join(including, " -> "), name)
 		}
-		return nil
-	}); err != nil {
-		return fmt.Errorf("Issue with '%s', %s", s.repoPath, err)
 	}
 
-	featureFile := path.Join(s.repoPath, name, name+".desc")
-	fd, err := os.Open(featureFile)
+	repoName, featureName := SplitFeatureName(name)
+	repo, err := s.getFeaturesRepo(repoName)
 	if err != nil {
+		return err
+	}
+
+	featureDesc := path.Join(featureName, featureName+".desc")
+	featureFile := path.Join(repo.Path(), featureDesc)
+
+	var commit string
+	var data []byte
+	if ref != "" {
+		if commit, err = repo.ResolveRef(ref); err != nil {
+			return fmt.Errorf("Unable to pin feature '%s'. %s", name, err)
+		}
+		var content string
+		if content, err = repo.showFile(commit, featureDesc); err != nil {
+			return fmt.Errorf("Unable to read feature file '%s'. %s", featureFile, err)
+		}
+		data = []byte(content)
+		gotrace.Trace("Feature '%s' pinned to '%s' (%s)", name, ref, commit)
+	} else if data, err = ioutil.ReadFile(featureFile); err != nil {
 		return fmt.Errorf("Unable to read feature file '%s'. %s", featureFile, err)
 	}
-	defer fd.Close()
 
-	fileScan := bufio.NewScanner(fd)
+	if loaded, found := s.features[name]; found {
+		if loaded != commit {
+			return fmt.Errorf("Feature '%s' requested at 2 different revisions ('%s' vs '%s')", name, loaded, commit)
+		}
+		gotrace.Trace("Feature '%s' already loaded.", name)
+		return nil
+	}
+	s.features[name] = commit
+
+	s.sources.AddData(DescSource, qualifiedName(repoName, featureDesc), repoName, ref, data)
+
+	fileScan := bufio.NewScanner(bytes.NewReader(data))
 	for fileScan.Scan() {
 		line := strings.Trim(fileScan.Text(), " \n")
 		if gotrace.IsDebugMode() {
 			fmt.Printf("== >> %s ==\n", line)
 		}
-		s.CheckElementLine(line, func(ftype, fname, version string) {
+		s.CheckElementLine(line, func(ftype, fname, version, options string) {
 			switch ftype {
+			case "feature":
+				// A nested feature is searched in the same repository, at the same commit, if not given.
+				nestedRepo, _ := SplitFeatureName(fname)
+				if nestedRepo == "" {
+					fname = qualifiedName(repoName, fname)
+					nestedRepo = repoName
+				}
+				if version == "" && nestedRepo == repoName {
+					version = commit
+				}
+				err = s.checkFeature(fname, version, append(including, name))
 			case "groovy":
-				err = s.CheckGroovy(path.Join(name, fname), s.repoPath)
+				err = s.CheckGroovy(path.Join(featureName, fname), repoName, commit, repo.Path())
+			case cascType, fileType:
+				err = s.CheckFile(ftype, path.Join(featureName, fname), version, repoName, commit, repo.Path())
 			case "plugin":
-				err = s.CheckPlugin(fname, version, nil)
+				if err = s.CheckPlugin(fname, version, nil); err == nil {
+					s.plugins[fname].addFeature(name)
+					err = s.plugins[fname].addStates(options)
+				}
 			default:
 				gotrace.Warning("feature type '%s' is currently not supported. Ignored.", ftype)
 				return
@@ -493,12 +686,41 @@ func (s *PluginsStatus) CheckFeature(name string) (_ error) {
 	return err
 }
 
-func (s *PluginsStatus) CheckGroovy(name, groovyPath string) error {
+// getFeaturesRepo return the features repository requested, cloned or updated if not local. It is done only once.
+// The default repository has an empty name. Named repositories are cloned in the jplugins cache directory.
+func (s *PluginsStatus) getFeaturesRepo(repoName string) (repo *FeaturesRepo, err error) {
+	if repoName != "" {
+		if repo, err = s.featuresRepos.get(repoName); err != nil {
+			return
+		}
+		return repo, repo.Prepare()
+	}
+
+	if s.featuresRepo == nil {
+		s.featuresRepo = NewFeaturesRepo(s.repoPath)
+		if len(s.repoURL) > 0 {
+			s.featuresRepo.SetURL(s.repoURL[0].String())
+		}
+		s.featuresRepo.SetRef(s.repoRef)
+		if s.useLocal {
+			s.featuresRepo.SetLocal()
+		}
+	}
+	return s.featuresRepo, s.featuresRepo.Prepare()
+}
+
+// CheckGroovy register a groovy file (path relative to the features repository) from the repository given.
+// ref is the commit ID the feature is pinned to, or empty to use the repository HEAD.
+func (s *PluginsStatus) CheckGroovy(groovyFile, repoName, ref, groovyPath string) error {
+	name := qualifiedName(repoName, groovyFile)
 
 	groovy, found := s.groovies[name]
+	if found && groovy.ref != ref {
+		return fmt.Errorf("Groovy '%s' requested at 2 different feature revisions ('%s' vs '%s')", name, groovy.ref, ref)
+	}
 	if !found {
-		if groovy = s.addGroovy(name, groovyPath); groovy == nil {
-			return fmt.Errorf("Unable to add %s several times", name)
+		if groovy = s.addGroovy(name, repoName, ref, groovyPath); groovy == nil {
+			return fmt.Errorf("Unable to add groovy '%s'", name)
 		}
 		gotrace.Trace("New groovy '%s' identified.", name)
 		s.groovies[name] = groovy
@@ -506,6 +728,57 @@ func (s *PluginsStatus) CheckGroovy(name, groovyPath string) error {
 	return nil
 }
 
+// CheckFile register a feature file (path relative to the features repository) from the repository given.
+// dest is the destination relative to the Jenkins home. By default, a casc file is installed in `casc_configs`.
+// ref is the commit ID the feature is pinned to, or empty to use the repository HEAD.
+func (s *PluginsStatus) CheckFile(fileType, file, dest, repoName, ref, sourcePath string) error {
+	name := qualifiedName(repoName, file)
+
+	if fileType == cascType {
+		dest = path.Join(jenkinsHomeCascPath, path.Base(file))
+	}
+	if dest == "" {
+		return fmt.Errorf("Invalid '%s:%s'. Requires a destination. Expect '%s:<src>:<dest>'", fileType, file, fileType)
+	}
+	if err := checkFileDest(dest); err != nil {
+		return err
+	}
+
+	if existing, found := s.files[name]; found {
+		if existing.dest != dest || existing.ref != ref {
+			return fmt.Errorf("%s file '%s' requested twice with different destinations or revisions", fileType, name)
+		}
+		return nil
+	}
+	for _, existing := range s.files {
+		if path.Clean(existing.dest) == path.Clean(dest) {
+			return fmt.Errorf("'%s' and '%s' are both installed as '%s'", existing.name, name, dest)
+		}
+	}
+
+	fileStatus := newFileStatusDetails(fileType, name, dest, sourcePath)
+	fileStatus.repoName = repoName
+	fileStatus.ref = ref
+	if !fileStatus.defineVersion(true) {
+		return fmt.Errorf("Unable to add %s file '%s'", fileType, name)
+	}
+	gotrace.Trace("New %s file '%s' identified.", fileType, name)
+	s.files[name] = fileStatus
+	return nil
+}
+
+// SetPluginStates add states (disabled, pinned) to a plugin already checked, as a comma separated list.
+func (s *PluginsStatus) SetPluginStates(name, states string) error {
+	if s == nil || states == "" {
+		return nil
+	}
+	plugin, found := s.plugins[name]
+	if !found {
+		return fmt.Errorf("Plugin '%s' not checked", name)
+	}
+	return plugin.addStates(states)
+}
+
 func (s *PluginsStatus) CheckPlugin(name, versionConstraints string, parentDependency *pluginsStatusDetails) error {
 	refPlugin, found := s.ref.Get(name)
 	if !found {
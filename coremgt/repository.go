@@ -13,7 +13,8 @@ import (
 )
 
 type Repository struct {
-	RepositoryPlugins  // Loaded from json with LoadFromURL and JenkinsRepoFile
+	RepositoryPlugins                 // Loaded from json with LoadFromURL and JenkinsRepoFile
+	Core               RepositoryCore `json:"core"`
 	historyPlugins     RepositoryPluginsHistory
 	loaded             bool
 	repoURLs           []*url.URL
@@ -7,6 +7,8 @@ import (
 	"jplugins/simplefile"
 	"os"
 	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	core "jplugins/coremgt"
@@ -24,16 +26,26 @@ type jPluginsApp struct {
 	checkVersions cmdCheckVersions
 	initCmd       cmdInit
 	installCmd    cmdInstall
+	diffCmd       cmdDiff
+	mergeLockCmd  cmdMergeLock
+	featureCmd    cmdFeature
+	rollbackCmd   cmdRollback
+	cacheCmd      cmdCache
+	bundleCmd     cmdBundle
+	exportCmd     cmdExport
 
 	installedElements *core.Plugins
 	repository        *core.Repository
 
-	jenkinsHome *core.JenkinsHome
+	jenkinsHome   *core.JenkinsHome
+	jenkinsRemote *core.JenkinsRemote
 }
 
 const (
 	defaultFeaturesRepoName = "jenkins-install-inits"
-	defaultFeaturesRepoPath = ".jplugins/repo-cache/" + defaultFeaturesRepoName
+	defaultFeaturesRepoPath = core.FeaturesReposCachePath + "/" + defaultFeaturesRepoName
+	defaultPluginsCachePath = ".jplugins/plugins-cache"
+	defaultCacheMaxSize     = "2048" // MB
 	defaultFeaturesRepoURL  = "https://github.com/forj-oss/" + defaultFeaturesRepoName
 	defaultJenkinsHome      = "/var/jenkins_home"
 	lockFileName            = "jplugins.lock"
@@ -54,6 +66,9 @@ func (a *jPluginsApp) init() {
 	a.listInstalled.cmd = a.app.Command("list-installed", "Display Jenkins plugins list of current Jenkins installation.")
 	a.listInstalled.jenkinsHomePath = a.listInstalled.cmd.Flag("jenkins-home", "Where Jenkins is installed.").Default(defaultJenkinsHome).String()
 	a.listInstalled.preInstalled = a.listInstalled.cmd.Flag("save-pre-installed", "To create the jplugins-preinstalled.lst instead displaying.").Bool()
+	a.listInstalled.jenkinsURL = a.listInstalled.cmd.Flag("jenkins-url", "URL of a running Jenkins to read plugins from its REST API, instead of the Jenkins home.").String()
+	a.listInstalled.jenkinsUser = a.listInstalled.cmd.Flag("jenkins-user", "Jenkins user for --jenkins-url.").Envar("JENKINS_USER").String()
+	a.listInstalled.jenkinsToken = a.listInstalled.cmd.Flag("jenkins-token", "Jenkins user API token for --jenkins-url.").Envar("JENKINS_TOKEN").String()
 
 	a.checkVersions.init()
 
@@ -63,8 +78,33 @@ func (a *jPluginsApp) init() {
 	a.installCmd.lockFile = a.installCmd.cmd.Flag("lock-file", "Full path to the lock file.").Default(lockFileName).String()
 	a.installCmd.featureRepoPath = a.installCmd.cmd.Flag("features-repo-path", "Path to a feature repository. "+
 		"By default, jplugins store the repo clone in jplugins cache directory.").Default(defaultFeaturesRepoPath).String()
-	a.installCmd.featureRepoURL = a.installCmd.cmd.Flag("features-repo-url", "URL to the feature repository. NOT IMPLEMENTED").Default(defaultFeaturesRepoURL).String()
+	a.installCmd.featureRepoURL = a.installCmd.cmd.Flag("features-repo-url", "URL to the feature repository.").Default(defaultFeaturesRepoURL).String()
+	a.installCmd.featureRepoRef = a.installCmd.cmd.Flag("features-repo-ref", "Branch, tag or commit ID of the feature repository to checkout.").String()
 	a.installCmd.jenkinsHomePath = a.installCmd.cmd.Flag("jenkins-home", "Where Jenkins is installed.").Default(defaultJenkinsHome).String()
+	a.installCmd.fromBundle = a.installCmd.cmd.Flag("from-bundle", "Install from a bundle built by 'jplugins bundle', with no network access. The lock file is not read.").String()
+	a.installCmd.warPath = a.installCmd.cmd.Flag("war-path", "Install the Jenkins war locked ('jenkins:<version>') to this file. Ex: /usr/share/jenkins/jenkins.war").String()
+	a.installCmd.warNoChecksum = a.installCmd.cmd.Flag("war-no-checksum", "Install the Jenkins war even if its sha256 is not locked. The war is not verified.").Bool()
+	a.installCmd.strict = a.installCmd.cmd.Flag("strict", "Fail if the features file or features descriptors have changed since the lock file was written.").Bool()
+	a.installCmd.backupPath = a.installCmd.cmd.Flag("backup-path", "Directory where snapshots of replaced files are saved. "+
+		"By default, '.jplugins-backups' in the Jenkins home.").String()
+	a.installCmd.jobs = a.installCmd.cmd.Flag("jobs", "Number of plugins downloaded in parallel.").Default(strconv.Itoa(core.DefaultJobs)).Int()
+	a.installCmd.cachePath = a.installCmd.cmd.Flag("cache-path", "Path to the plugins packages cache, shared by installs.").Default(defaultPluginsCachePath).String()
+	a.installCmd.cacheMaxSize = a.installCmd.cmd.Flag("cache-max-size", "Maximum plugins cache size in MB. Least recently used packages are removed after install. 0 means no limit.").Default(defaultCacheMaxSize).Int()
+	a.installCmd.noCache = a.installCmd.cmd.Flag("no-cache", "Do not use the plugins packages cache.").Bool()
+	a.installCmd.retries = a.installCmd.cmd.Flag("retries", "Number of retries of a failed plugin download. HTTP 5xx and 429 are retried.").Default(strconv.Itoa(core.DefaultDownloadConfig().Retries)).Int()
+	a.installCmd.retryBackoff = a.installCmd.cmd.Flag("retry-backoff", "Delay before the first retry. It is doubled at each retry, with jitter.").Default(core.DefaultDownloadConfig().Backoff.String()).Duration()
+	a.installCmd.downloadTimeout = a.installCmd.cmd.Flag("download-timeout", "Timeout of each plugin download request.").Default(core.DefaultDownloadConfig().Timeout.String()).Duration()
+	a.installCmd.dryRun = a.installCmd.cmd.Flag("dry-run", "Display the install plan without changing the Jenkins home.").Bool()
+	a.installCmd.format = a.installCmd.cmd.Flag("format", "Install plan output format: text or json.").Default(textFormat).Enum(textFormat, jsonFormat)
+	a.installCmd.backups = a.installCmd.cmd.Flag("backups", "Number of snapshots to keep. 0 disables snapshots.").Default(strconv.Itoa(core.DefaultBackups)).Int()
+
+	a.diffCmd.init()
+	a.mergeLockCmd.init()
+	a.featureCmd.init()
+	a.rollbackCmd.init()
+	a.cacheCmd.init()
+	a.bundleCmd.init()
+	a.exportCmd.init()
 
 	// Do not use default git wrapper logOut function.
 	git.SetLogFunc(func(msg string) {
@@ -76,6 +116,16 @@ func (a *jPluginsApp) setJenkinsHome(jenkinsHomePath string) {
 	a.jenkinsHome = core.NewJenkinsHome(jenkinsHomePath)
 }
 
+// setJenkinsURL select a running Jenkins, read through its REST API, instead of the Jenkins home.
+// Nothing is selected if jenkinsURL is empty.
+func (a *jPluginsApp) setJenkinsURL(jenkinsURL, user, token string) {
+	if jenkinsURL == "" {
+		return
+	}
+	a.jenkinsRemote = core.NewJenkinsRemote(jenkinsURL)
+	a.jenkinsRemote.SetAuth(user, token)
+}
+
 func (a *jPluginsApp) writeLockFile(lockFileName string, lockData *core.PluginsStatus) (_ bool) {
 
 	err := lockData.WriteSimple(lockFileName)
@@ -88,7 +138,67 @@ func (a *jPluginsApp) writeLockFile(lockFileName string, lockData *core.PluginsS
 	return true
 }
 
-func (a *jPluginsApp) readFeatures(featurePath, featureFile, featureURL string, lockData *core.PluginsStatus) (_ bool) {
+// addFeaturesFileSource record the features file hash in the lock data.
+// The features file is referenced relatively to the lock file path.
+func (a *jPluginsApp) addFeaturesFileSource(lockFileName, featureFile string, lockData *core.PluginsStatus) (_ bool) {
+	lockPath, err := filepath.Abs(path.Dir(lockFileName))
+	if err != nil {
+		gotrace.Error("Invalid lock file path '%s'. %s", lockFileName, err)
+		return
+	}
+	featurePath, err := filepath.Abs(featureFile)
+	if err != nil {
+		gotrace.Error("Invalid features file path '%s'. %s", featureFile, err)
+		return
+	}
+	name, err := filepath.Rel(lockPath, featurePath)
+	if err != nil {
+		name = featurePath
+	}
+
+	if err = lockData.AddSourceFile(core.LstSource, name, featureFile); err != nil {
+		gotrace.Error("%s", err)
+		return
+	}
+	return true
+}
+
+// checkLockSources verify if files used to build the lock file (features file and features descriptors)
+// have changed since the lock file was written.
+// In strict mode, a stale lock file is an error. Otherwise, it is reported as warning.
+func (a *jPluginsApp) checkLockSources(lockFileName, featuresRepoPath string, strict bool) (_ bool) {
+	sources := core.NewLockSources()
+	if err := sources.Read(lockFileName); err != nil {
+		gotrace.Error("%s", err)
+		return
+	}
+	if sources.Length() == 0 {
+		gotrace.Trace("No sources hashes recorded in '%s'. Not verified.", lockFileName)
+		return true
+	}
+
+	changes := sources.Check(path.Dir(lockFileName), featuresRepoPath)
+	if len(changes) == 0 {
+		gotrace.Trace("'%s' is up to date with its sources.", lockFileName)
+		return true
+	}
+
+	for _, change := range changes {
+		if strict {
+			gotrace.Error("%s", change)
+		} else {
+			gotrace.Warning("%s", change)
+		}
+	}
+	if strict {
+		gotrace.Error("'%s' is stale. Please update it with 'jplugins init lockfile'.", lockFileName)
+		return
+	}
+	gotrace.Warning("'%s' may be stale. Please update it with 'jplugins init lockfile'.", lockFileName)
+	return true
+}
+
+func (a *jPluginsApp) readFeatures(featurePath, featureFile, featureURL, featureRef string, lockData *core.PluginsStatus) (_ bool) {
 	gotrace.Trace("Loading constraints...")
 	if gotrace.IsDebugMode() {
 		fmt.Printf("Reading %s\n--------\n", featureFileName)
@@ -105,6 +215,7 @@ func (a *jPluginsApp) readFeatures(featurePath, featureFile, featureURL string,
 	}
 	lockData.SetFeaturesPath(featurePath)
 	lockData.SetFeaturesRepoURL(featureURL)
+	lockData.SetFeaturesRepoRef(featureRef)
 
 	bError := false
 	fileScan := bufio.NewScanner(fd)
@@ -113,10 +224,21 @@ func (a *jPluginsApp) readFeatures(featurePath, featureFile, featureURL string,
 		if gotrace.IsDebugMode() {
 			fmt.Printf("== %s ==\n", line)
 		}
-		lockData.CheckElementLine(line, func(ftype, name, version string) {
+		lockData.CheckElementLine(line, func(ftype, name, version, options string) {
 			switch ftype {
+			case "repo":
+				if err = lockData.AddFeaturesRepo(name, version); err != nil {
+					gotrace.Error("%s", err)
+					bError = true
+				}
+			case "jenkins":
+				// `jenkins:<version>`. The name field is the core version.
+				if err = lockData.SetJenkinsCore(name); err != nil {
+					gotrace.Error("%s", err)
+					bError = true
+				}
 			case "feature":
-				if err = lockData.CheckFeature(name); err != nil {
+				if err = lockData.CheckFeature(name, version); err != nil {
 					gotrace.Error("%s", err)
 					bError = true
 				}
@@ -125,6 +247,9 @@ func (a *jPluginsApp) readFeatures(featurePath, featureFile, featureURL string,
 				if err := lockData.CheckPlugin(name, version, nil); err != nil {
 					gotrace.Error("%s", err)
 					bError = true
+				} else if err := lockData.SetPluginStates(name, options); err != nil {
+					gotrace.Error("%s", err)
+					bError = true
 				}
 			default:
 				gotrace.Warning("feature type '%s' is currently not supported. Ignored.", ftype)
@@ -148,11 +273,16 @@ func (a *jPluginsApp) readFeatures(featurePath, featureFile, featureURL string,
 		return
 	}
 
+	if !lockData.CheckJenkinsCore() {
+		gotrace.Error("Plugins locked require a newer Jenkins core. Please update the 'jenkins:<version>' record of '%s'.", featureFileName)
+		return
+	}
+
 	return true
 }
 
 // readFeaturesFromSimpleFormat will load a feature file and expand them to get a list of plugins/groovies/... (elements)
-func (a *jPluginsApp) readFeaturesFromSimpleFormat(featurePath, featureFile, featureURL string) (elements *core.ElementsType, err error) {
+func (a *jPluginsApp) readFeaturesFromSimpleFormat(featurePath, featureFile, featureURL, featureRef string) (elements *core.ElementsType, err error) {
 	if gotrace.IsDebugMode() {
 		fmt.Println("******** Loading features and build constraints ********")
 	}
@@ -164,13 +294,20 @@ func (a *jPluginsApp) readFeaturesFromSimpleFormat(featurePath, featureFile, fea
 	}
 	elements.SetFeaturesPath(featurePath)
 	elements.SetFeaturesRepoURL(featureURL)
+	elements.SetFeaturesRepoRef(featureRef)
 	elements.SetRepository(a.repository)
 
 	feature := simplefile.NewSimpleFile(featureFile, 3)
 
 	bError := false
 	feature.Read(":", func(fields []string) (_ error) {
-		_, err := elements.Add(fields...)
+		var err error
+		if fields[0] == "repo" && len(fields) >= 3 {
+			// The repository URL can contain ':'
+			err = elements.AddFeaturesRepo(fields[1], strings.Join(fields[2:], ":"))
+		} else {
+			_, err = elements.Add(fields...)
+		}
 
 		if err != nil {
 			gotrace.Error("%s", err)
@@ -186,8 +323,28 @@ func (a *jPluginsApp) readFeaturesFromSimpleFormat(featurePath, featureFile, fea
 	return
 }
 
+// prepareFeaturesRepo clone or update the features repository, except if a local path is given.
+func (a *jPluginsApp) prepareFeaturesRepo(featurePath, featureURL, featureRef string) (_ bool) {
+	featuresRepo := core.NewFeaturesRepo(featurePath)
+	if featurePath != defaultFeaturesRepoPath {
+		featuresRepo.SetLocal()
+	}
+	featuresRepo.SetURL(featureURL)
+	featuresRepo.SetRef(featureRef)
+
+	if err := featuresRepo.Prepare(); err != nil {
+		gotrace.Error("%s", err)
+		return
+	}
+	return true
+}
+
 // checkJenkinsHome verify if the path given exist or not
+// A Jenkins URL is always selected. It is verified when plugins are read.
 func (a *jPluginsApp) checkJenkinsHome() (_ bool) {
+	if a.jenkinsRemote != nil {
+		return true
+	}
 	if a.jenkinsHome == nil {
 		return
 	}
@@ -196,7 +353,11 @@ func (a *jPluginsApp) checkJenkinsHome() (_ bool) {
 }
 
 // readFromJenkins read manifest of each plugins and store information in a.installedPlugins
+// If a Jenkins URL is selected, plugins are read from the Jenkins REST API.
 func (a *jPluginsApp) readFromJenkins() (elements *core.ElementsType, _ error) {
+	if a.jenkinsRemote != nil {
+		return a.jenkinsRemote.GetPlugins()
+	}
 	if a.jenkinsHome == nil {
 		return
 	}
@@ -209,13 +370,15 @@ func (a *jPluginsApp) checkSimpleFormatFile(filepath, file string) (_ bool) {
 	return utils.CheckFile(filepath, file)
 }
 
-// readFromSimpleFormat read a simple description file for plugins or groovies.
+// readFromSimpleFormat read a simple description file for plugins, groovies or feature files.
 func (a *jPluginsApp) readFromSimpleFormat(filepath, fileName string) (elements *core.ElementsType, _ error) {
 	file := path.Join(filepath, fileName)
 	elements = core.NewElementsType()
 
-	elements.AddSupport("plugin", "groovy")
-	elements.AddSupportContext("groovy", "noMoreContext", "true")
+	elements.AddSupport("plugin", "groovy", "casc", "file")
+	for _, elementType := range []string{"groovy", "casc", "file"} {
+		elements.AddSupportContext(elementType, "noMoreContext", "true")
+	}
 	elements.SetRepository(a.repository)
 
 	err := elements.Read(file, 3)
@@ -234,7 +397,11 @@ func (a *jPluginsApp) printOutVersion(plugins *core.ElementsType) (_ bool) {
 
 	plugins.PrintOut(func(element core.Element) {
 		version, _ := element.GetVersion()
-		fmt.Printf("%s: %s\n", element.Name(), version)
+		states := ""
+		if plugin, ok := element.(*core.Plugin); ok && len(plugin.States()) > 0 {
+			states = " (" + strings.Join(plugin.States(), ", ") + ")"
+		}
+		fmt.Printf("%s: %s%s\n", element.Name(), version, states)
 
 	})
 
@@ -22,9 +22,29 @@ func main() {
 		App.initCmd.lockfile.DoInitLockfile()
 	case App.initCmd.features.cmd.FullCommand():
 		App.initCmd.features.DoInitFeatures()
+	case App.initCmd.preInstalled.cmd.FullCommand():
+		App.initCmd.preInstalled.DoInitPreInstalled()
 		/*	case App.update.cmd.FullCommand():
 			App.doUpdate()*/
 	case App.installCmd.cmd.FullCommand():
 		App.installCmd.doInstall()
+	case App.diffCmd.cmd.FullCommand():
+		App.diffCmd.doDiff()
+	case App.mergeLockCmd.cmd.FullCommand():
+		App.mergeLockCmd.doMergeLock()
+	case App.featureCmd.list.cmd.FullCommand():
+		App.featureCmd.list.DoFeatureList()
+	case App.featureCmd.show.cmd.FullCommand():
+		App.featureCmd.show.DoFeatureShow()
+	case App.featureCmd.lint.cmd.FullCommand():
+		App.featureCmd.lint.DoFeatureLint()
+	case App.rollbackCmd.cmd.FullCommand():
+		App.rollbackCmd.doRollback()
+	case App.cacheCmd.gc.cmd.FullCommand():
+		App.cacheCmd.DoCacheGC()
+	case App.bundleCmd.cmd.FullCommand():
+		App.bundleCmd.doBundle()
+	case App.exportCmd.cmd.FullCommand():
+		App.exportCmd.doExport()
 	}
 }
@@ -3,6 +3,7 @@ package simplefile
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"sort"
@@ -117,7 +118,22 @@ func (s *SimpleFile) Read(sep string, treatData func([]string) (error)) (_ error
 		}
 	}()
 
-	scanFile := bufio.NewScanner(fd)
+	s.scan(fd, sep, treatData)
+	return
+}
+
+// ReadData read simple format data given instead of the file. The file name is used for debug messages only.
+func (s *SimpleFile) ReadData(data string, sep string, treatData func([]string) error) (_ error) {
+	if gotrace.IsDebugMode() {
+		fmt.Printf("Reading %s\n--------\n", s.file)
+	}
+
+	s.scan(strings.NewReader(data), sep, treatData)
+	return
+}
+
+func (s *SimpleFile) scan(reader io.Reader, sep string, treatData func([]string) error) {
+	scanFile := bufio.NewScanner(reader)
 
 	for scanFile.Scan() {
 		line := scanFile.Text()
@@ -134,5 +150,4 @@ func (s *SimpleFile) Read(sep string, treatData func([]string) (error)) (_ error
 
 		treatData(pluginRecord)
 	}
-	return
 }